@@ -0,0 +1,260 @@
+// Package audit records the requests and responses of sensitive endpoints,
+// with their bodies up to a size limit, redacting the credential headers and
+// the configured JSON and form fields.
+//
+//	auditor := audit.New(sink)
+//	auditor.RedactFields = []string{"password", "card_number"}
+//	r.With(auditor.Middleware()).Post("/users/{id}/password", changePassword)
+//
+// Records are written to the sink when the request ends.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the audit middleware.
+const Name = "audit"
+
+// Redacted replaces the redacted values.
+const Redacted = "[REDACTED]"
+
+// DefaultMaxBodySize is the default body size limit of the records.
+const DefaultMaxBodySize = 64 << 10
+
+// DefaultRedactHeaders are the headers redacted by default.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Record is the audit record of a request.
+type Record struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id,omitempty"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Route     string        `json:"route,omitempty"`
+	ClientIP  string        `json:"client_ip,omitempty"`
+	Principal string        `json:"principal,omitempty"`
+	Status    int           `json:"status"`
+	Duration  time.Duration `json:"duration"`
+
+	Request  Message `json:"request"`
+	Response Message `json:"response"`
+}
+
+// Message is the header and body of a request or a response.
+type Message struct {
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+
+	// Truncated reports whether the body exceeds the size limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Auditor records the requests into a sink.
+type Auditor struct {
+	Sink Sink
+
+	// MaxBodySize is the size limit of the recorded bodies. Defaults to
+	// DefaultMaxBodySize. Negative doesn't record the bodies.
+	MaxBodySize int
+
+	// RedactHeaders are the redacted headers. Defaults to
+	// DefaultRedactHeaders.
+	RedactHeaders []string
+
+	// RedactFields are the redacted fields of the JSON bodies, at any depth,
+	// and of the form bodies. Names are case insensitive. If set, bodies of
+	// other media types, such as multipart forms, are recorded as Redacted.
+	RedactFields []string
+
+	now func() time.Time
+}
+
+// New returns a new auditor of the sink.
+func New(sink Sink) *Auditor {
+	return &Auditor{Sink: sink, now: time.Now}
+}
+
+// Middleware returns the named audit middleware.
+func (a *Auditor) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: a.Handler}
+}
+
+// Handler is the audit middleware handler.
+func (a *Auditor) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	begin := a.now()
+	limit := a.MaxBodySize
+	if limit == 0 {
+		limit = DefaultMaxBodySize
+	}
+
+	rec := &Record{
+		Time:      begin,
+		RequestID: rctx.RequestID,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		ClientIP:  rctx.ClientIP,
+		Request:   Message{Header: a.redactHeader(r.Header)},
+	}
+
+	// the request body is read up to the limit, and replayed to the handler
+	if limit > 0 && r.Body != nil && r.Body != http.NoBody {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+		if err != nil && rctx.Log != nil {
+			rctx.Log.Errorf("audit: read request body failed: %v", err)
+		}
+		r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		rec.Request.Body, rec.Request.Truncated = a.redactBody(r.Header.Get("Content-Type"), body, limit)
+	}
+
+	// the response body is copied by the writers that support it
+	response := &limitedBuffer{limit: limit}
+	tee, _ := chain.Writer.(xroute.WrapResponseWriter)
+	if limit > 0 && tee != nil {
+		tee.Tee(response)
+	}
+
+	defer func() {
+		if tee != nil {
+			tee.Tee(nil)
+		}
+		rec.Duration = a.now().Sub(begin)
+		rec.Route = rctx.RoutePattern()
+		if p := rctx.Principal(); p != nil {
+			rec.Principal = p.ID
+		}
+		if rec.Status = chain.Writer.Status(); rec.Status == 0 {
+			rec.Status = http.StatusOK
+		}
+		rec.Response.Header = a.redactHeader(chain.Writer.Header())
+		if limit > 0 {
+			rec.Response.Body, rec.Response.Truncated = a.redactBody(chain.Writer.Header().Get("Content-Type"), response.Bytes(), limit)
+		}
+
+		if a.Sink != nil {
+			if err := a.Sink.Write(rec); err != nil && rctx.Log != nil {
+				rctx.Log.Errorf("audit: write record failed: %v", err)
+			}
+		}
+	}()
+
+	chain.Next()
+}
+
+func (a *Auditor) redactHeader(header http.Header) http.Header {
+	names := a.RedactHeaders
+	if names == nil {
+		names = DefaultRedactHeaders
+	}
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		h[k] = append([]string(nil), v...)
+	}
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := h[name]; ok {
+			h[name] = []string{Redacted}
+		}
+	}
+	return h
+}
+
+// redactBody returns the recorded body, and whether it exceeds the limit.
+// Bodies that can't be redacted, because they are truncated, malformed or of
+// other media types, are replaced by Redacted if there are fields to redact.
+func (a *Auditor) redactBody(contentType string, body []byte, limit int) (string, bool) {
+	truncated := len(body) > limit
+	if truncated {
+		body = body[:limit]
+	}
+	if len(a.RedactFields) == 0 || len(body) == 0 {
+		return string(body), truncated
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil || truncated {
+			return Redacted, truncated
+		}
+		for k := range values {
+			if a.redacted(k) {
+				values[k] = []string{Redacted}
+			}
+		}
+		return values.Encode(), truncated
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+		if truncated || json.Unmarshal(body, &v) != nil {
+			return Redacted, truncated
+		}
+		data, err := json.Marshal(a.redactJSON(v))
+		if err != nil {
+			return Redacted, truncated
+		}
+		return string(data), truncated
+	}
+	return Redacted, truncated
+}
+
+func (a *Auditor) redactJSON(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for k, value := range vt {
+			if a.redacted(k) {
+				vt[k] = Redacted
+			} else {
+				vt[k] = a.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range vt {
+			vt[i] = a.redactJSON(value)
+		}
+	}
+	return v
+}
+
+func (a *Auditor) redacted(field string) bool {
+	for _, name := range a.RedactFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedBuffer keeps the first `limit` bytes written, and one more to
+// report the truncation.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit + 1 - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
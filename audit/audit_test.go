@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func TestAuditor(t *testing.T) {
+	records := make(chan *Record, 10)
+	a := New(ChanSink(records))
+	a.MaxBodySize = 80
+	a.RedactFields = []string{"password"}
+
+	r := xroute.NewRouter()
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("Set-Cookie", "sid=secret")
+		w.Write(body)
+	}
+	r.With(a.Middleware()).Post("/users/{id}/password", echo)
+	r.Post("/public", echo)
+
+	do := func(path, contentType, body string) string {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	body := `{"user":{"name":"ann","password":"secret"},"tags":[{"Password":"x"}]}`
+	if got := do("/users/1/password", "application/json", body); got != body {
+		t.Fatalf("expecting body replayed, got %q", got)
+	}
+	rec := <-records
+	if rec.Route != "/users/{id}/password" || rec.Status != 200 || rec.Path != "/users/1/password" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if rec.Request.Header.Get("Authorization") != Redacted || rec.Response.Header.Get("Set-Cookie") != Redacted {
+		t.Fatalf("expecting redacted headers, got %v %v", rec.Request.Header, rec.Response.Header)
+	}
+	expected := `{"tags":[{"Password":"[REDACTED]"}],"user":{"name":"ann","password":"[REDACTED]"}}`
+	if rec.Request.Body != expected || rec.Response.Body != expected || rec.Request.Truncated {
+		t.Fatalf("expecting redacted bodies, got %q %q", rec.Request.Body, rec.Response.Body)
+	}
+
+	do("/users/1/password", "application/x-www-form-urlencoded", "name=ann&password=secret")
+	if rec = <-records; rec.Request.Body != "name=ann&password=%5BREDACTED%5D" {
+		t.Fatalf("expecting redacted form, got %q", rec.Request.Body)
+	}
+
+	long := strings.Repeat("a", 100)
+	if got := do("/users/1/password", "text/plain", long); got != long {
+		t.Fatalf("expecting full body replayed, got %d bytes", len(got))
+	}
+	if rec = <-records; rec.Request.Body != Redacted || !rec.Request.Truncated || !rec.Response.Truncated {
+		t.Fatalf("expecting truncated bodies, got %+v", rec)
+	}
+	do("/users/1/password", "application/json", `{"password":"`+long+`"}`)
+	if rec = <-records; rec.Request.Body != Redacted {
+		t.Fatalf("expecting truncated JSON redacted, got %q", rec.Request.Body)
+	}
+
+	// bodies that can't be redacted aren't recorded
+	multipart := "--x\r\nContent-Disposition: form-data; name=\"password\"\r\n\r\nsecret\r\n--x--\r\n"
+	if got := do("/users/1/password", "multipart/form-data; boundary=x", multipart); got != multipart {
+		t.Fatalf("expecting body replayed, got %q", got)
+	}
+	if rec = <-records; rec.Request.Body != Redacted || rec.Response.Body != Redacted {
+		t.Fatalf("expecting multipart redacted, got %q %q", rec.Request.Body, rec.Response.Body)
+	}
+	do("/users/1/password", "", "password=secret")
+	if rec = <-records; rec.Request.Body != Redacted {
+		t.Fatalf("expecting untyped body redacted, got %q", rec.Request.Body)
+	}
+
+	a.RedactFields = nil
+	do("/users/1/password", "text/plain", long)
+	if rec = <-records; len(rec.Request.Body) != 80 || !rec.Request.Truncated || !rec.Response.Truncated {
+		t.Fatalf("expecting truncated bodies, got %+v", rec)
+	}
+
+	do("/public", "text/plain", "x")
+	select {
+	case rec = <-records:
+		t.Fatalf("expecting unaudited route, got %+v", rec)
+	default:
+	}
+}
+
+func TestJSONSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONSink(&buf)
+	if err := sink.Write(&Record{Method: "POST", Path: "/a", Status: 201}); err != nil {
+		t.Fatal(err)
+	}
+	var rec Record
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil || rec.Status != 201 || !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		t.Fatalf("unexpected line %q: %v", buf.String(), err)
+	}
+
+	full := ChanSink(make(chan *Record))
+	if err := full.Write(&rec); err != ErrDropped {
+		t.Fatalf("expecting ErrDropped, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrDropped is returned by ChanSink when the channel is full.
+var ErrDropped = errors.New("audit: record dropped")
+
+// Sink writes the audit records.
+type Sink interface {
+	Write(rec *Record) error
+}
+
+// SinkFunc is a function sink.
+type SinkFunc func(rec *Record) error
+
+func (f SinkFunc) Write(rec *Record) error {
+	return f(rec)
+}
+
+// ChanSink sends the records to a channel, without blocking: records are
+// dropped when the channel is full.
+type ChanSink chan<- *Record
+
+func (c ChanSink) Write(rec *Record) error {
+	select {
+	case c <- rec:
+		return nil
+	default:
+		return ErrDropped
+	}
+}
+
+// JSONSink writes the records as JSON, one per line.
+type JSONSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONSink returns a new JSON sink writing to `w`.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{w: w}
+}
+
+// NewFileSink returns a new JSON sink appending to the file `path`. The file
+// is closed by Close.
+func NewFileSink(path string) (*JSONSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONSink(f), nil
+}
+
+func (s *JSONSink) Write(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the writer, if it's an io.Closer.
+func (s *JSONSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
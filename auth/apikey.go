@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// APIKeyLookup returns the principal of the API key, or nil if it's invalid.
+type APIKeyLookup func(key string, r *http.Request) *xroute.Principal
+
+// APIKey returns the API key authentication middleware. The key is read from
+// the `header`, then from the `query` param. Either of them may be empty.
+func APIKey(header, query string, lookup APIKeyLookup) *xroute.Middleware {
+	return New(APIKeyName, "", func(r *http.Request, rctx *xroute.RouteContext) (*xroute.Principal, error) {
+		var key string
+		if header != "" {
+			key = r.Header.Get(header)
+		}
+		if key == "" && query != "" {
+			key = r.URL.Query().Get(query)
+		}
+		if key == "" {
+			return nil, nil
+		}
+		p := lookup(key, r)
+		if p == nil {
+			return nil, ErrInvalidCredentials
+		}
+		if p.Scheme == "" {
+			cp := *p
+			cp.Scheme = "APIKey"
+			p = &cp
+		}
+		return p, nil
+	})
+}
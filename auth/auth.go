@@ -0,0 +1,80 @@
+// Package auth implements the authentication middlewares of xroute: Basic
+// auth, Bearer JWTs verified locally and API keys.
+//
+// The middlewares set the authenticated principal of the request (see
+// xroute.RouteContext.Principal), to be authorized by the authz package:
+//
+//	keys, err := auth.LoadJWKS("jwks.json")
+//	...
+//	r.Use(auth.Bearer(keys, auth.JWTOptions{Issuer: "https://id.example.com"}))
+//	r.Use(auth.APIKey("X-Api-Key", "api_key", lookupKey))
+//	r.HandlerIntersept(az.Interseptor())
+//
+// Requests without credentials pass with no principal, so the middlewares can
+// be combined, and the first authenticated principal wins. Requests with
+// invalid credentials are replied 401 through xroute.ServeError.
+//
+// The middlewares are named, and ordered after the RealIP and RequestID
+// middlewares and before the authz middleware, if they are registered in the
+// same stack.
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// The names of the authentication middlewares.
+const (
+	BasicName  = "auth_basic"
+	BearerName = "auth_bearer"
+	APIKeyName = "auth_apikey"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidToken       = errors.New("invalid token")
+)
+
+var (
+	// runAfter are the middlewares the authentication runs after.
+	runAfter = []string{"realip", "request_id"}
+	// runBefore are the middlewares the authentication runs before.
+	runBefore = []string{"authz"}
+)
+
+// Authenticator reads the credentials of the request. It returns a nil
+// principal and a nil error if the request has no credentials.
+type Authenticator func(r *http.Request, rctx *xroute.RouteContext) (*xroute.Principal, error)
+
+// New returns the named authentication middleware of `authenticate`.
+// `challenge`, if not empty, is the WWW-Authenticate header value replied
+// with invalid credentials.
+func New(name, challenge string, authenticate Authenticator) *xroute.Middleware {
+	return &xroute.Middleware{
+		Name:           name,
+		OptionalBefore: runBefore,
+		OptionalAfter:  runAfter,
+		Handler: func(chain *xroute.ChainHandler) {
+			r, rctx := chain.Request(), chain.Context
+			if rctx.Principal() != nil {
+				chain.Next()
+				return
+			}
+			p, err := authenticate(r, rctx)
+			if err != nil {
+				if challenge != "" {
+					chain.Writer.Header().Set("WWW-Authenticate", challenge)
+				}
+				xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusUnauthorized, err))
+				return
+			}
+			if p != nil {
+				rctx.SetPrincipal(p)
+			}
+			chain.Next()
+		},
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims Claims) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func whoami(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+	if p := rctx.Principal(); p != nil {
+		w.Write([]byte(p.Scheme + ":" + p.ID))
+	}
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBasicAndAPIKey(t *testing.T) {
+	r := xroute.NewRouter()
+	r.Use(Basic("admin", func(user, password string, r *http.Request) *xroute.Principal {
+		if user == "ann" && password == "secret" {
+			return &xroute.Principal{ID: user}
+		}
+		return nil
+	}))
+	r.Use(APIKey("X-Api-Key", "api_key", func(key string, r *http.Request) *xroute.Principal {
+		if key == "k1" {
+			return &xroute.Principal{ID: "ci"}
+		}
+		return nil
+	}))
+	r.Get("/", whoami)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	if w := serve(r, req); w.Code != 200 || w.Body.String() != "" {
+		t.Fatalf("anonymous: unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	req.SetBasicAuth("ann", "secret")
+	if w := serve(r, req); w.Body.String() != "Basic:ann" {
+		t.Fatalf("basic: unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	req.SetBasicAuth("ann", "bad")
+	w := serve(r, req)
+	if w.Code != 401 || w.Header().Get("WWW-Authenticate") != `Basic realm="admin"` {
+		t.Fatalf("bad basic: unexpected response %d %v", w.Code, w.Header())
+	}
+
+	req, _ = http.NewRequest("GET", "/?api_key=k1", nil)
+	if w := serve(r, req); w.Body.String() != "APIKey:ci" {
+		t.Fatalf("api key: unexpected response %d %q", w.Code, w.Body.String())
+	}
+	req.Header.Set("X-Api-Key", "k2")
+	if w := serve(r, req); w.Code != 401 {
+		t.Fatalf("bad api key: unexpected response %d", w.Code)
+	}
+}
+
+func TestBearer(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("0123456789abcdef")
+
+	// JWKS file with an HMAC and an RSA key
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "h1", "k": base64.RawURLEncoding.EncodeToString(secret)},
+		{"kty": "RSA", "kid": "r1",
+			"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := ioutil.WriteFile(path, jwks, 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJWKS(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	opts := JWTOptions{Issuer: "id", Audience: "api", Leeway: time.Minute, now: func() time.Time { return now }}
+	r := xroute.NewRouter()
+	r.Use(Bearer(keys, opts))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		p := rctx.Principal()
+		w.Write([]byte(p.ID + " " + p.Roles[0] + " " + p.Permissions[1]))
+	})
+
+	claims := Claims{"sub": "ann", "iss": "id", "aud": []string{"web", "api"}, "roles": []string{"admin"},
+		"scope": "users.read users.write", "exp": now.Add(time.Hour).Unix()}
+	expired := Claims{"sub": "ann", "iss": "id", "aud": "api", "exp": now.Add(-2 * time.Minute).Unix()}
+	otherIssuer := Claims{"sub": "ann", "iss": "other", "aud": "api"}
+
+	tests := []struct {
+		token  string
+		status int
+	}{
+		{signJWT(t, "HS256", "h1", secret, claims), 200},
+		{signJWT(t, "RS256", "r1", rsaKey, claims), 200},
+		{signJWT(t, "HS256", "h1", []byte("wrong"), claims), 401},
+		{signJWT(t, "HS256", "r1", rsaKey.N.Bytes(), claims), 401},
+		{signJWT(t, "RS256", "h1", rsaKey, claims), 401},
+		{signJWT(t, "HS256", "h1", secret, expired), 401},
+		{signJWT(t, "HS256", "h1", secret, otherIssuer), 401},
+		{"not.a.token", 401},
+	}
+	for i, tt := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := serve(r, req)
+		if w.Code != tt.status {
+			t.Fatalf("input [%d]: expecting %d, got %d %q", i, tt.status, w.Code, w.Body.String())
+		}
+		if tt.status == 200 && w.Body.String() != "ann admin users.write" {
+			t.Fatalf("input [%d]: unexpected principal %q", i, w.Body.String())
+		}
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	var order []string
+	named := func(name string) *xroute.Middleware {
+		return &xroute.Middleware{Name: name, Handler: func(chain *xroute.ChainHandler) {
+			order = append(order, name)
+			chain.Next()
+		}}
+	}
+	apiKey := APIKey("X-Api-Key", "", func(key string, r *http.Request) *xroute.Principal { return nil })
+	handler := apiKey.Handler
+	apiKey.Handler = func(chain *xroute.ChainHandler) {
+		order = append(order, APIKeyName)
+		handler(chain)
+	}
+
+	r := xroute.NewRouter()
+	r.Use(named("authz"), apiKey, named("request_id"), named("realip"))
+	r.Get("/", whoami)
+	serve(r, httptest.NewRequest("GET", "/", nil))
+
+	pos := map[string]int{}
+	for i, name := range order {
+		pos[name] = i
+	}
+	if len(order) != 4 || pos[APIKeyName] < pos["realip"] || pos[APIKeyName] < pos["request_id"] || pos[APIKeyName] > pos["authz"] {
+		t.Fatalf("unexpected middlewares order %v", order)
+	}
+}
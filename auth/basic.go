@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// BasicVerifier returns the principal of the user and password, or nil if
+// they are invalid.
+type BasicVerifier func(user, password string, r *http.Request) *xroute.Principal
+
+// Basic returns the Basic authentication middleware of `realm`.
+func Basic(realm string, verify BasicVerifier) *xroute.Middleware {
+	return New(BasicName, "Basic realm="+strconv.Quote(realm), func(r *http.Request, rctx *xroute.RouteContext) (*xroute.Principal, error) {
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			return nil, nil
+		}
+		p := verify(user, password, r)
+		if p == nil {
+			return nil, ErrInvalidCredentials
+		}
+		if p.Scheme == "" {
+			cp := *p
+			cp.Scheme = "Basic"
+			p = &cp
+		}
+		return p, nil
+	})
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// KeySet are the JWT verification keys by key ID: HS256 secrets ([]byte) and
+// RS256 public keys (*rsa.PublicKey).
+type KeySet struct {
+	Keys map[string]interface{}
+}
+
+// NewKeySet returns a new empty key set.
+func NewKeySet() *KeySet {
+	return &KeySet{Keys: map[string]interface{}{}}
+}
+
+// AddHMAC adds the HS256 secret of `kid`.
+func (ks *KeySet) AddHMAC(kid string, secret []byte) *KeySet {
+	ks.Keys[kid] = secret
+	return ks
+}
+
+// AddRSA adds the RS256 public key of `kid`.
+func (ks *KeySet) AddRSA(kid string, key *rsa.PublicKey) *KeySet {
+	ks.Keys[kid] = key
+	return ks
+}
+
+// key returns the key of `kid`. Tokens without a key ID are verified with
+// the only key of the set.
+func (ks *KeySet) key(kid string) interface{} {
+	if kid == "" && len(ks.Keys) == 1 {
+		for _, key := range ks.Keys {
+			return key
+		}
+	}
+	return ks.Keys[kid]
+}
+
+// LoadJWKS loads the key set of the JWKS file `path`. Keys of type `oct`
+// are HS256 secrets and keys of type `RSA` are RS256 public keys. Other keys
+// are ignored.
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses the JWKS `data`, like LoadJWKS.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("auth: bad JWKS: %v", err)
+	}
+	ks := NewKeySet()
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("auth: bad JWKS key %q: %v", k.Kid, err)
+			}
+			ks.AddHMAC(k.Kid, secret)
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("auth: bad JWKS key %q: %v", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("auth: bad JWKS key %q exponent", k.Kid)
+			}
+			ks.AddRSA(k.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+		}
+	}
+	return ks, nil
+}
+
+// JWTOptions are the JWT claim checks.
+type JWTOptions struct {
+	// Issuer, if not empty, is the required `iss` claim.
+	Issuer string
+
+	// Audience, if not empty, must be in the `aud` claim.
+	Audience string
+
+	// Leeway is the clock skew allowed for the `exp` and `nbf` claims.
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+// Claims are the claims of a JWT.
+type Claims map[string]interface{}
+
+// String returns the string claim `name`.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns the claim `name` as strings: a string array, or a space
+// separated string, like the `scope` claim.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	if v, ok := c[name].(float64); ok {
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+// Bearer returns the Bearer JWT authentication middleware. The principal ID
+// is the `sub` claim, the roles are the `roles` claim, the permissions are
+// the `scope` claim and the attributes are all the claims.
+func Bearer(keys *KeySet, opts JWTOptions) *xroute.Middleware {
+	return New(BearerName, "Bearer", func(r *http.Request, rctx *xroute.RouteContext) (*xroute.Principal, error) {
+		h := r.Header.Get("Authorization")
+		if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+			return nil, nil
+		}
+		claims, err := VerifyJWT(strings.TrimSpace(h[7:]), keys, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &xroute.Principal{
+			ID:          claims.String("sub"),
+			Roles:       claims.Strings("roles"),
+			Permissions: claims.Strings("scope"),
+			Attributes:  claims,
+			Scheme:      "Bearer",
+		}, nil
+	})
+}
+
+// VerifyJWT verifies the signature and the claims of the HS256 or RS256
+// `token`, and returns its claims.
+func VerifyJWT(token string, keys *KeySet, opts JWTOptions) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// the algorithm must match the type of the key, so public keys are
+	// never used as HMAC secrets
+	signed := []byte(parts[0] + "." + parts[1])
+	switch key := keys.key(header.Kid).(type) {
+	case []byte:
+		if header.Alg != "HS256" {
+			return nil, ErrInvalidToken
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, ErrInvalidToken
+		}
+		sum := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) != nil {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := opts.check(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (opts JWTOptions) check(claims Claims) error {
+	now := time.Now()
+	if opts.now != nil {
+		now = opts.now()
+	}
+	if exp, ok := claims.time("exp"); ok && !now.Before(exp.Add(opts.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(opts.Leeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+	if opts.Issuer != "" && claims.String("iss") != opts.Issuer {
+		return ErrInvalidToken
+	}
+	if opts.Audience != "" {
+		aud := claims.Strings("aud")
+		if s := claims.String("aud"); s != "" {
+			aud = []string{s}
+		}
+		var ok bool
+		for _, a := range aud {
+			ok = ok || a == opts.Audience
+		}
+		if !ok {
+			return ErrInvalidToken
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if json.Unmarshal(data, v) != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Package authz authorizes requests against the requirements declared in the
+// route metadata, with role based permissions and attribute policies.
+//
+// Requirements are declared at registration time:
+//
+//	r.With(xroute.Meta{authz.Perm: "users.read"}).Get("/users/{id}", showUser)
+//	r.With(xroute.Meta{authz.Role: "admin"}).Delete("/users/{id}", deleteUser)
+//	r.With(xroute.Meta{authz.Policy: "owner"}).Put("/users/{id}", updateUser)
+//	r.With(xroute.Meta{authz.Public: true}).Get("/health", health)
+//
+// The authorizer is a handler interseptor, so it runs after routing, with the
+// metadata of the matched endpoint, and before the handler:
+//
+//	az := authz.New(map[string][]string{"admin": {"*"}, "reader": {"users.read"}})
+//	az.Policies["owner"] = func(p *xroute.Principal, r *http.Request, rctx *xroute.RouteContext) bool {
+//		return p.ID == rctx.URLParam("id")
+//	}
+//	r.HandlerIntersept(az.Interseptor())
+//
+// Requests without a principal (see xroute.RouteContext.Principal) to
+// protected routes are replied 401, and the ones the principal isn't granted
+// 403, both through xroute.ServeError.
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the authorization interseptor.
+const Name = "authz"
+
+// The route metadata keys of the requirements. Perm, Role and Policy values
+// are a string, a []string or a []interface{} of strings. Values of other
+// types are invalid, and the requests to their routes are replied 500.
+const (
+	// Perm are the permissions required, all of them.
+	Perm = "perm"
+	// Role are the roles required, any of them.
+	Role = "role"
+	// Policy are the names of the attribute policies required, all of them.
+	Policy = "policy"
+	// Public, if true, skips the authorization.
+	Public = "public"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("access denied")
+)
+
+// PolicyFunc is an attribute based policy: it reports whether the principal
+// may access the route of the request.
+type PolicyFunc func(p *xroute.Principal, r *http.Request, rctx *xroute.RouteContext) bool
+
+// Authorizer authorizes the requests.
+type Authorizer struct {
+	// Roles are the permissions of each role. The `*` permission grants all
+	// permissions, and `prefix.*` the ones starting with `prefix.`.
+	Roles map[string][]string
+
+	// Policies are the attribute policies by name.
+	Policies map[string]PolicyFunc
+
+	// DenyUnprotected denies the requests to routes without requirements
+	// that aren't public.
+	DenyUnprotected bool
+}
+
+// New returns a new authorizer of the role permissions.
+func New(roles map[string][]string) *Authorizer {
+	return &Authorizer{Roles: roles, Policies: map[string]PolicyFunc{}}
+}
+
+// Requirements are the access requirements of a route.
+type Requirements struct {
+	Perms    []string
+	Roles    []string
+	Policies []string
+	Public   bool
+
+	// Invalid are the metadata keys with values of invalid types. The
+	// requests to routes with invalid requirements are denied.
+	Invalid []string
+}
+
+// RequirementsOf returns the requirements of the route metadata.
+func RequirementsOf(meta xroute.Meta) Requirements {
+	var req Requirements
+	for _, v := range []struct {
+		key    string
+		values *[]string
+	}{{Perm, &req.Perms}, {Role, &req.Roles}, {Policy, &req.Policies}} {
+		values, ok := metaStrings(meta[v.key])
+		if !ok {
+			req.Invalid = append(req.Invalid, v.key)
+		}
+		*v.values = values
+	}
+	if v, ok := meta[Public]; ok {
+		if req.Public, ok = v.(bool); !ok {
+			req.Invalid = append(req.Invalid, Public)
+		}
+	}
+	return req
+}
+
+// IsZero reports whether there are no requirements.
+func (req Requirements) IsZero() bool {
+	return !req.Public && len(req.Perms) == 0 && len(req.Roles) == 0 && len(req.Policies) == 0 && len(req.Invalid) == 0
+}
+
+// String returns the requirements, as shown in the report:
+//
+//	perm=users.read,users.write role=admin policy=owner
+//
+// Invalid requirements are shown as `INVALID perm,role`.
+func (req Requirements) String() string {
+	if len(req.Invalid) > 0 {
+		return "INVALID " + strings.Join(req.Invalid, ",")
+	}
+	if req.Public {
+		return "public"
+	}
+	var items []string
+	for _, v := range []struct {
+		name   string
+		values []string
+	}{{Perm, req.Perms}, {Role, req.Roles}, {Policy, req.Policies}} {
+		if len(v.values) > 0 {
+			items = append(items, v.name+"="+strings.Join(v.values, ","))
+		}
+	}
+	return strings.Join(items, " ")
+}
+
+// Interseptor returns the named authorization handler interseptor.
+func (a *Authorizer) Interseptor() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: a.Handler}
+}
+
+// Handler is the authorization interseptor handler.
+func (a *Authorizer) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	if err := a.Authorize(r, rctx); err != nil {
+		xroute.ServeError(chain.Writer, r, rctx, err)
+		return
+	}
+	chain.Next()
+}
+
+// Authorize checks the principal of the request against the requirements of
+// the matched route. It returns an *xroute.HTTPError of status 401 or 403 if
+// the access is denied, or 500 if the requirements are invalid.
+func (a *Authorizer) Authorize(r *http.Request, rctx *xroute.RouteContext) error {
+	req := RequirementsOf(rctx.Meta)
+	if len(req.Invalid) > 0 {
+		return xroute.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("authz: invalid requirements %s", strings.Join(req.Invalid, ",")))
+	}
+	if req.Public {
+		return nil
+	}
+	if req.IsZero() {
+		if a.DenyUnprotected {
+			return xroute.NewHTTPError(http.StatusForbidden, ErrForbidden)
+		}
+		return nil
+	}
+
+	p := rctx.Principal()
+	if p == nil {
+		return xroute.NewHTTPError(http.StatusUnauthorized, ErrUnauthenticated)
+	}
+	if len(req.Roles) > 0 && !p.HasRole(req.Roles...) {
+		return xroute.NewHTTPError(http.StatusForbidden, ErrForbidden)
+	}
+	for _, perm := range req.Perms {
+		if !a.Granted(p, perm) {
+			return xroute.NewHTTPError(http.StatusForbidden, ErrForbidden)
+		}
+	}
+	for _, name := range req.Policies {
+		policy, ok := a.Policies[name]
+		if !ok {
+			return xroute.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("authz: undefined policy %q", name))
+		}
+		if !policy(p, r, rctx) {
+			return xroute.NewHTTPError(http.StatusForbidden, ErrForbidden)
+		}
+	}
+	return nil
+}
+
+// Granted reports whether the principal has the permission `perm`, directly
+// or by one of its roles.
+func (a *Authorizer) Granted(p *xroute.Principal, perm string) bool {
+	if permMatch(p.Permissions, perm) {
+		return true
+	}
+	for _, role := range p.Roles {
+		if permMatch(a.Roles[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+func permMatch(granted []string, perm string) bool {
+	for _, g := range granted {
+		if g == perm || g == "*" || (strings.HasSuffix(g, ".*") && strings.HasPrefix(perm, g[:len(g)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// metaStrings returns the values of a metadata requirement. It reports false
+// if the type of `v` is invalid.
+func metaStrings(v interface{}) ([]string, bool) {
+	switch vt := v.(type) {
+	case nil:
+	case string:
+		if vt != "" {
+			return []string{vt}, true
+		}
+	case []string:
+		values := append([]string(nil), vt...)
+		sort.Strings(values)
+		return values, true
+	case []interface{}:
+		values := make([]string, len(vt))
+		for i, item := range vt {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			values[i] = s
+		}
+		sort.Strings(values)
+		return values, true
+	default:
+		return nil, false
+	}
+	return nil, true
+}
@@ -0,0 +1,127 @@
+package authz
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func newRouter(az *Authorizer) *xroute.Mux {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	users := map[string]*xroute.Principal{
+		"ann": {ID: "ann", Roles: []string{"reader"}},
+		"bob": {ID: "bob", Roles: []string{"admin"}},
+		"eve": {ID: "eve", Permissions: []string{"users.read"}},
+	}
+
+	r := xroute.NewRouter()
+	r.Use(func(chain *xroute.ChainHandler) {
+		if p, ok := users[chain.Request().Header.Get("X-User")]; ok {
+			chain.Context.SetPrincipal(p)
+		}
+		chain.Next()
+	})
+	r.HandlerIntersept(az.Interseptor())
+	r.With(xroute.Meta{Public: true}).Get("/health", ok)
+	r.With(xroute.Meta{Perm: "users.read"}).Get("/users/{id}", ok)
+	r.With(xroute.Meta{Perm: []string{"users.read", "users.write"}, Policy: "owner"}).Put("/users/{id}", ok)
+	r.With(xroute.Meta{Role: "admin"}).Delete("/users/{id}", ok)
+	r.Post("/webhooks", ok)
+	r.With(xroute.Meta{Role: []interface{}{"ops", "admin"}}).Get("/jobs", ok)
+	r.With(xroute.Meta{Perm: []interface{}{"jobs.read", 1}}).Get("/broken", ok)
+	r.With(xroute.Meta{Perm: "reports.read"}).Route("/reports", func(r xroute.Router) {
+		r.Get("/daily", ok)
+	})
+	return r
+}
+
+func TestAuthorizer(t *testing.T) {
+	az := New(map[string][]string{
+		"admin":  {"*"},
+		"reader": {"users.*"},
+	})
+	az.Policies["owner"] = func(p *xroute.Principal, r *http.Request, rctx *xroute.RouteContext) bool {
+		return p.ID == rctx.URLParam("id")
+	}
+	r := newRouter(az)
+
+	tests := []struct {
+		method, path, user string
+		status             int
+	}{
+		{"GET", "/health", "", 200},
+		{"GET", "/users/1", "", 401},
+		{"GET", "/users/1", "ann", 200},
+		{"GET", "/users/1", "eve", 200},
+		{"PUT", "/users/ann", "ann", 200},
+		{"PUT", "/users/bob", "ann", 403},
+		{"PUT", "/users/eve", "eve", 403},
+		{"DELETE", "/users/1", "ann", 403},
+		{"DELETE", "/users/1", "bob", 200},
+		{"POST", "/webhooks", "", 200},
+		{"GET", "/jobs", "ann", 403},
+		{"GET", "/jobs", "bob", 200},
+		{"GET", "/broken", "bob", 500},
+		{"GET", "/reports/daily", "ann", 403},
+		{"GET", "/reports/daily", "bob", 200},
+	}
+	for i, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-User", tt.user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Fatalf("input [%d]: %s %s as %q expecting %d, got %d", i, tt.method, tt.path, tt.user, tt.status, w.Code)
+		}
+	}
+
+	az.DenyUnprotected = true
+	req, _ := http.NewRequest("POST", "/webhooks", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 403 {
+		t.Fatalf("expecting unprotected route denied, got %d", w.Code)
+	}
+}
+
+func TestAuthorizerErrorHandler(t *testing.T) {
+	r := newRouter(New(nil))
+	r.SetErrorHandler(func(URL *url.URL, debug bool, w xroute.ResponseWriter, r *http.Request, rctx *xroute.RouteContext, begin time.Time, err interface{}) {
+		w.WriteHeader(xroute.ErrorStatus(err))
+		w.Write([]byte(`{"error":"` + err.(error).Error() + `"}`))
+	})
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 401 || w.Body.String() != `{"error":"authentication required"}` {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestReport(t *testing.T) {
+	az := New(nil)
+	var buf bytes.Buffer
+	if err := az.WriteReport(&buf, newRouter(az)); err != nil {
+		t.Fatal(err)
+	}
+	expected := `GET /broken INVALID perm
+GET /health public
+GET /jobs role=admin,ops
+GET /reports/*/daily perm=reports.read
+DELETE /users/{id} role=admin
+GET /users/{id} perm=users.read
+PUT /users/{id} perm=users.read,users.write policy=owner
+POST /webhooks NO POLICY
+`
+	if buf.String() != expected {
+		t.Fatalf("expecting report:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// RouteReport is the effective policy of a route handler.
+type RouteReport struct {
+	Method       string
+	Route        string
+	Constraints  string
+	Requirements Requirements
+
+	// Unprotected reports whether the route has no requirements and isn't
+	// public.
+	Unprotected bool
+}
+
+// Report returns the effective policy of each route handler of `routes`,
+// sorted by route and method.
+func (a *Authorizer) Report(routes xroute.Routes) []RouteReport {
+	var reports []RouteReport
+	xroute.WalkEndpoints(routes, func(method string, route string, v xroute.EndpointVariant, middlewares ...*xroute.Middleware) error {
+		req := RequirementsOf(v.Meta)
+		reports = append(reports, RouteReport{
+			Method:       method,
+			Route:        route,
+			Constraints:  v.Constraints.String(),
+			Requirements: req,
+			Unprotected:  req.IsZero(),
+		})
+		return nil
+	})
+	sort.SliceStable(reports, func(i, j int) bool {
+		if reports[i].Route != reports[j].Route {
+			return reports[i].Route < reports[j].Route
+		}
+		return reports[i].Method < reports[j].Method
+	})
+	return reports
+}
+
+// WriteReport writes the report of `routes`, a line per route handler.
+// Unprotected routes are flagged with `NO POLICY`, or `DENIED` if the
+// authorizer denies them, and routes with invalid requirements with
+// `INVALID`:
+//
+//	GET /health public
+//	GET /users/{id} perm=users.read
+//	POST /webhooks NO POLICY
+//	GET /jobs INVALID role
+func (a *Authorizer) WriteReport(w io.Writer, routes xroute.Routes) error {
+	for _, rep := range a.Report(routes) {
+		line := rep.Method + " " + rep.Route
+		if rep.Constraints != "" {
+			line += " " + rep.Constraints
+		}
+		switch {
+		case !rep.Unprotected:
+			line += " " + rep.Requirements.String()
+		case a.DenyUnprotected:
+			line += " DENIED"
+		default:
+			line += " NO POLICY"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package xroute
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge is returned by the reads of the request bodies larger than
+// the limit of BodyLimit. It's replied 413 by ServeError.
+var ErrBodyTooLarge = NewHTTPError(http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+
+// BodyLimit returns a middleware that limits the request bodies to `n` bytes.
+// Requests with a larger Content-Length are replied 413. Otherwise, the
+// reads past the limit fail with ErrBodyTooLarge, and the request is replied
+// 413 if the handler doesn't write a response. Attach it with With to limit
+// the bodies of the route:
+//
+//	r.With(xroute.BodyLimit(10 << 20)).Post("/avatars", uploadAvatar)
+func BodyLimit(n int64) *Middleware {
+	return &Middleware{Handler: func(chain *ChainHandler) {
+		r := chain.Request()
+		if r.ContentLength > n {
+			ServeError(chain.Writer, r, chain.Context, ErrBodyTooLarge)
+			return
+		}
+		if r.Body == nil || r.Body == http.NoBody {
+			chain.Next()
+			return
+		}
+		body := &limitedBody{body: r.Body, n: n}
+		r.Body = body
+		chain.Next()
+		if body.exceeded && chain.Writer.Status() == 0 {
+			ServeError(chain.Writer, r, chain.Context, ErrBodyTooLarge)
+		}
+	}}
+}
+
+// limitedBody is a request body that fails with ErrBodyTooLarge after `n`
+// bytes.
+type limitedBody struct {
+	body     io.ReadCloser
+	n        int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (n int, err error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	// one more byte is read to detect the overflow
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err = b.body.Read(p)
+	if int64(n) > b.n {
+		n, err = int(b.n), ErrBodyTooLarge
+		b.exceeded = true
+	}
+	b.n -= int64(n)
+	return
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
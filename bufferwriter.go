@@ -0,0 +1,209 @@
+package xroute
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// BufferedWriter is a ResponseWriter that holds the response until it's
+// committed, so the middlewares can inspect and rewrite the status, the
+// header and the body after the chain returns:
+//
+//	bw := xroute.NewBufferedWriter(chain.Writer, 1<<20)
+//	defer bw.Commit()
+//	chain.Next(bw)
+//	if bw.Buffered() && bw.Status() == http.StatusNotFound {
+//		bw.SetBody([]byte("custom page"))
+//	}
+//
+// When the body exceeds the limit, the handler flushes or the connection is
+// hijacked, the writer switches to streaming: the held response is sent and
+// the next writes are proxied.
+type BufferedWriter struct {
+	ResponseWriter
+
+	// Limit is the size limit of the held body. Zero is unlimited.
+	Limit int
+
+	status      int
+	wroteHeader bool
+	streaming   bool
+	buf         bytes.Buffer
+	sent        int
+	tee         io.Writer
+}
+
+// NewBufferedWriter returns a new buffered writer of `w`, holding up to
+// `limit` bytes of the body.
+func NewBufferedWriter(w http.ResponseWriter, limit int) *BufferedWriter {
+	return &BufferedWriter{ResponseWriter: NewResponseWriter(w), Limit: limit}
+}
+
+func (bw *BufferedWriter) WriteHeader(code int) {
+	if !bw.wroteHeader {
+		bw.wroteHeader = true
+		bw.status = code
+		if bw.streaming {
+			bw.ResponseWriter.WriteHeader(code)
+		}
+	}
+}
+
+func (bw *BufferedWriter) Write(p []byte) (n int, err error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if !bw.streaming && bw.Limit > 0 && bw.buf.Len()+len(p) > bw.Limit {
+		if err = bw.stream(); err != nil {
+			return
+		}
+	}
+	if bw.streaming {
+		n, err = bw.ResponseWriter.Write(p)
+		bw.sent += n
+	} else {
+		n, err = bw.buf.Write(p)
+	}
+	if bw.tee != nil {
+		bw.tee.Write(p[:n])
+	}
+	return
+}
+
+// stream sends the held response, and proxies the next writes.
+func (bw *BufferedWriter) stream() error {
+	if bw.streaming {
+		return nil
+	}
+	bw.streaming = true
+	if bw.wroteHeader {
+		bw.ResponseWriter.WriteHeader(bw.status)
+	}
+	if bw.buf.Len() > 0 {
+		n, err := bw.ResponseWriter.Write(bw.buf.Bytes())
+		bw.sent += n
+		bw.buf.Reset()
+		return err
+	}
+	return nil
+}
+
+// Commit sends the held response. The next writes are proxied.
+func (bw *BufferedWriter) Commit() error {
+	return bw.stream()
+}
+
+// Buffered reports whether the response is held, so it can be rewritten.
+func (bw *BufferedWriter) Buffered() bool {
+	return !bw.streaming
+}
+
+// Body returns the held body.
+func (bw *BufferedWriter) Body() []byte {
+	return bw.buf.Bytes()
+}
+
+// SetStatus replaces the held status.
+func (bw *BufferedWriter) SetStatus(code int) {
+	if !bw.streaming {
+		bw.wroteHeader = true
+		bw.status = code
+	}
+}
+
+// SetBody replaces the held body, and the Content-Length header if set.
+func (bw *BufferedWriter) SetBody(body []byte) {
+	if bw.streaming {
+		return
+	}
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	bw.buf.Reset()
+	bw.buf.Write(body)
+	if bw.Header().Get("Content-Length") != "" {
+		bw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+}
+
+// Reset discards the held status and body, so a new response can be
+// written.
+func (bw *BufferedWriter) Reset() {
+	if !bw.streaming {
+		bw.wroteHeader = false
+		bw.status = 0
+		bw.buf.Reset()
+	}
+}
+
+func (bw *BufferedWriter) Flush() {
+	bw.stream()
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (bw *BufferedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := HijackResponseWriter(bw.ResponseWriter)
+	if err == nil {
+		bw.streaming = true
+		bw.wroteHeader = true
+		bw.status = http.StatusSwitchingProtocols
+		bw.buf.Reset()
+		bw.tee = nil
+	}
+	return conn, rw, err
+}
+
+// Status returns the status of the response, or 0 if one has not yet been
+// written.
+func (bw *BufferedWriter) Status() int {
+	return bw.status
+}
+
+func (bw *BufferedWriter) HasStatus(status ...int) bool {
+	for _, s := range status {
+		if bw.status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// BytesWritten returns the size of the response body: the bytes sent to the
+// client and the held ones.
+func (bw *BufferedWriter) BytesWritten() int {
+	return bw.sent + bw.buf.Len()
+}
+
+func (bw *BufferedWriter) Tee(w io.Writer) {
+	bw.tee = w
+}
+
+func (bw *BufferedWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// ResponseRewriter returns a middleware that holds the responses up to
+// `limit` bytes, and calls `rewrite` with the held ones before they are
+// sent.
+func ResponseRewriter(limit int, rewrite func(bw *BufferedWriter, r *http.Request, rctx *RouteContext)) *Middleware {
+	return &Middleware{Handler: func(chain *ChainHandler) {
+		bw := NewBufferedWriter(chain.Writer, limit)
+		defer bw.Commit()
+		chain.Next(bw)
+		if bw.Buffered() {
+			rewrite(bw, chain.Request(), chain.Context)
+		}
+	}}
+}
+
+var (
+	_ WrapResponseWriter = &BufferedWriter{}
+	_ http.Flusher       = &BufferedWriter{}
+	_ http.Hijacker      = &BufferedWriter{}
+)
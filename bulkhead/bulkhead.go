@@ -0,0 +1,168 @@
+// Package bulkhead implements route level deadlines and concurrency limits,
+// so slow endpoints can't starve the others.
+//
+// Policies are middlewares, set with With, Group or Route:
+//
+//	reports := bulkhead.New("reports", 4, 16, 2*time.Second)
+//	r.Route("/reports", func(r xroute.Router) {
+//		r.Use(bulkhead.Timeout(30*time.Second), reports.Middleware())
+//		r.Get("/{id}", showReport)
+//	})
+package bulkhead
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Stats are the bulkhead metrics.
+type Stats struct {
+	InFlight int64
+	Queued   int64
+	Served   int64
+	Rejected int64
+	TimedOut int64
+}
+
+// Bulkhead limits the number of in-flight requests. Requests above the limit
+// wait in a queue; when the queue is full or the queue timeout expires, 503
+// Service Unavailable is replied.
+type Bulkhead struct {
+	Name         string
+	MaxInFlight  int
+	MaxQueue     int
+	QueueTimeout time.Duration
+
+	// RetryAfter is the `Retry-After` header value of rejected requests.
+	// Defaults to the queue timeout, or one second.
+	RetryAfter time.Duration
+
+	sem chan struct{}
+
+	inFlight int64
+	queued   int64
+	served   int64
+	rejected int64
+	timedOut int64
+}
+
+// New returns a new bulkhead. If `queueTimeout` is zero, queued requests
+// wait until their context is done.
+func New(name string, maxInFlight, maxQueue int, queueTimeout time.Duration) *Bulkhead {
+	if maxInFlight <= 0 {
+		panic("bulkhead: maxInFlight must be greater than zero")
+	}
+	return &Bulkhead{
+		Name:         name,
+		MaxInFlight:  maxInFlight,
+		MaxQueue:     maxQueue,
+		QueueTimeout: queueTimeout,
+		sem:          make(chan struct{}, maxInFlight),
+	}
+}
+
+// Stats returns the current metrics.
+func (b *Bulkhead) Stats() Stats {
+	return Stats{
+		InFlight: atomic.LoadInt64(&b.inFlight),
+		Queued:   atomic.LoadInt64(&b.queued),
+		Served:   atomic.LoadInt64(&b.served),
+		Rejected: atomic.LoadInt64(&b.rejected),
+		TimedOut: atomic.LoadInt64(&b.timedOut),
+	}
+}
+
+// Middleware returns the bulkhead middleware.
+func (b *Bulkhead) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Handler: b.Handler}
+}
+
+// Handler is the bulkhead middleware handler.
+func (b *Bulkhead) Handler(chain *xroute.ChainHandler) {
+	if !b.acquire(chain) {
+		return
+	}
+	atomic.AddInt64(&b.inFlight, 1)
+	defer func() {
+		atomic.AddInt64(&b.inFlight, -1)
+		atomic.AddInt64(&b.served, 1)
+		<-b.sem
+	}()
+	chain.Next()
+}
+
+func (b *Bulkhead) acquire(chain *xroute.ChainHandler) bool {
+	select {
+	case b.sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	if depth := atomic.AddInt64(&b.queued, 1); depth > int64(b.MaxQueue) {
+		atomic.AddInt64(&b.queued, -1)
+		b.reject(chain, http.StatusServiceUnavailable, "queue full")
+		return false
+	} else {
+		b.logf(chain.Context, false, "queued (depth %d)", depth)
+	}
+	defer atomic.AddInt64(&b.queued, -1)
+
+	var timeout <-chan time.Time
+	if b.QueueTimeout > 0 {
+		timer := time.NewTimer(b.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	ctx := chain.Request().Context()
+	select {
+	case b.sem <- struct{}{}:
+		return true
+	case <-timeout:
+		b.reject(chain, http.StatusServiceUnavailable, "queue timeout")
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			b.reject(chain, http.StatusGatewayTimeout, "deadline exceeded while queued")
+		} else {
+			atomic.AddInt64(&b.rejected, 1)
+		}
+	}
+	return false
+}
+
+func (b *Bulkhead) reject(chain *xroute.ChainHandler, status int, reason string) {
+	if status == http.StatusGatewayTimeout {
+		atomic.AddInt64(&b.timedOut, 1)
+	} else {
+		atomic.AddInt64(&b.rejected, 1)
+	}
+
+	b.logf(chain.Context, true, "%s", reason)
+
+	retryAfter := b.RetryAfter
+	if retryAfter == 0 {
+		retryAfter = b.QueueTimeout
+	}
+	chain.Writer.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	http.Error(chain.Writer, http.StatusText(status), status)
+}
+
+func (b *Bulkhead) logf(rctx *xroute.RouteContext, warning bool, format string, args ...interface{}) {
+	if rctx == nil || rctx.Log == nil {
+		return
+	}
+	s := b.Stats()
+	format = "bulkhead %q: " + format + " [in-flight=%d queued=%d rejected=%d timed-out=%d]"
+	args = append([]interface{}{b.Name}, args...)
+	args = append(args, s.InFlight, s.Queued, s.Rejected, s.TimedOut)
+	if warning {
+		rctx.Log.Warningf(format, args...)
+	} else {
+		rctx.Log.Debugf(format, args...)
+	}
+}
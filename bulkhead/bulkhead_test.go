@@ -0,0 +1,120 @@
+package bulkhead
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func TestTimeout(t *testing.T) {
+	r := xroute.NewRouter()
+	r.Use(Timeout(time.Second))
+
+	r.With(Timeout(20*time.Millisecond)).Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Header().Set("X-Late", "1")
+		w.Write([]byte("late"))
+	})
+	r.With(Timeout(time.Hour)).Get("/deadline", func(w http.ResponseWriter, r *http.Request) {
+		// the outer deadline is kept
+		if d, ok := r.Context().Deadline(); !ok || time.Until(d) > time.Second {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout || w.Header().Get("Retry-After") != "1" || w.Header().Get("X-Late") != "" {
+		t.Fatalf("expected 504, got %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/deadline", nil))
+	if w.Code != 200 || w.Body.String() != "ok" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	b := New("slow", 1, 1, 50*time.Millisecond)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	r := xroute.NewRouter()
+	r.Route("/slow", func(r xroute.Router) {
+		r.Use(b.Middleware())
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+			w.Write([]byte("ok"))
+		})
+	})
+	r.Get("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	})
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan int, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results <- do("/slow").Code
+	}()
+	<-started
+
+	// queue full
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results <- do("/slow").Code
+	}()
+	for b.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if w := do("/slow"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 503, got %d %v", w.Code, w.Header())
+	}
+	// other routes aren't limited
+	if w := do("/fast"); w.Code != 200 {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	// queued request times out
+	if code := <-results; code != http.StatusServiceUnavailable {
+		t.Fatalf("expected queue timeout, got %d", code)
+	}
+
+	// queued request is served when the slot is released
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results <- do("/slow").Code
+	}()
+	for b.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+	wg.Wait()
+	if c1, c2 := <-results, <-results; c1 != 200 || c2 != 200 {
+		t.Fatalf("unexpected status %d %d", c1, c2)
+	}
+
+	if s := b.Stats(); s.InFlight != 0 || s.Queued != 0 || s.Served != 2 || s.Rejected != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
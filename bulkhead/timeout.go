@@ -0,0 +1,125 @@
+package bulkhead
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Timeout returns a middleware that sets the request deadline to `d`. The
+// deadline is propagated to the next handlers through the request context.
+// Handlers should watch `r.Context().Done()`: if the deadline expires before
+// the response is started, 504 Gateway Timeout is replied and the late
+// writes are discarded.
+//
+// Nested timeouts keep the earliest deadline.
+func Timeout(d time.Duration) *xroute.Middleware {
+	return &xroute.Middleware{Handler: func(chain *xroute.ChainHandler) {
+		ctx, cancel := context.WithTimeout(chain.Request().Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{ResponseWriter: chain.Writer, ctx: ctx, rctx: chain.Context, timeout: d}
+		chain.Next(ctx, xroute.ResponseWriter(tw))
+
+		if ctx.Err() == context.DeadlineExceeded && !tw.started {
+			tw.timedOut()
+		}
+	}}
+}
+
+// timeoutWriter replies 504 instead of the handler response when the
+// deadline expires before the response is started.
+type timeoutWriter struct {
+	xroute.ResponseWriter
+
+	ctx     context.Context
+	rctx    *xroute.RouteContext
+	timeout time.Duration
+	started bool
+	discard bool
+	tee     io.Writer
+}
+
+func (tw *timeoutWriter) start() bool {
+	if !tw.started {
+		if tw.ctx.Err() == context.DeadlineExceeded {
+			tw.timedOut()
+		}
+		tw.started = true
+	}
+	return !tw.discard
+}
+
+func (tw *timeoutWriter) timedOut() {
+	tw.started = true
+	tw.discard = true
+
+	if tw.rctx != nil && tw.rctx.Log != nil {
+		tw.rctx.Log.Warningf("request deadline of %s exceeded", tw.timeout)
+	}
+
+	header := tw.ResponseWriter.Header()
+	for k := range header {
+		delete(header, k)
+	}
+	header.Set("Retry-After", strconv.Itoa(retryAfterSeconds(tw.timeout)))
+	http.Error(tw.ResponseWriter, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.start() {
+		tw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	if !tw.start() {
+		return 0, http.ErrHandlerTimeout
+	}
+	n, err := tw.ResponseWriter.Write(p)
+	if tw.tee != nil {
+		tw.tee.Write(p[:n])
+	}
+	return n, err
+}
+
+func (tw *timeoutWriter) Flush() {
+	if tw.start() {
+		if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := xroute.HijackResponseWriter(tw.ResponseWriter)
+	if err == nil {
+		tw.started = true
+		tw.tee = nil
+	}
+	return conn, rw, err
+}
+
+func (tw *timeoutWriter) Tee(w io.Writer) {
+	tw.tee = w
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+var _ xroute.WrapResponseWriter = &timeoutWriter{}
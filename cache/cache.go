@@ -0,0 +1,460 @@
+// Package cache implements HTTP caching helpers for xroute: an ETag
+// middleware that answers conditional requests, and an in-memory LRU
+// response cache.
+//
+// The response cache keys entries by method, matched route pattern, URL
+// params, query string and the request headers listed in the response
+// `Vary` header. Requests with Authorization only use and store the
+// responses marked `public` or `s-maxage`. It must run after routing, so it
+// is attached with inline middlewares:
+//
+//	c := cache.New(1000)
+//	r.With(c.Middleware(), cache.RouteName("users"), cache.Tag("accounts")).Get("/users/{id}", showUser)
+//	r.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+//		// ...
+//		c.InvalidateRoute("users")
+//	})
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the response cache middleware.
+const Name = "response-cache"
+
+// DefaultMaxEntrySize is the default maximum body size of a cached response.
+const DefaultMaxEntrySize = 1 << 20
+
+type (
+	cacheKey struct{}
+	tagsKey  struct{}
+	nameKey  struct{}
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Key     string
+	Route   string
+	Tags    []string
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time
+
+	// Shared reports whether the response opted in to be served to
+	// requests with Authorization, with `public` or `s-maxage`.
+	Shared bool
+
+	baseKey string
+}
+
+// varyIndex records the Vary header names of the last response stored for a
+// base key, and the number of entries stored for it.
+type varyIndex struct {
+	names []string
+	refs  int
+}
+
+// Cache is an in-memory LRU response cache.
+type Cache struct {
+	// MaxEntrySize is the maximum body size of a cached response.
+	MaxEntrySize int
+
+	// DefaultTTL is used for responses without `max-age` or `s-maxage`
+	// directives. Zero means these responses are not stored.
+	DefaultTTL time.Duration
+
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[string]*list.Element
+	vary    map[string]*varyIndex
+	tags    map[string]map[string]bool
+	routes  map[string]map[string]bool
+}
+
+// New returns a new cache holding up to `maxEntries` responses.
+func New(maxEntries int) *Cache {
+	return &Cache{
+		MaxEntrySize: DefaultMaxEntrySize,
+		maxEntries:   maxEntries,
+		now:          time.Now,
+		ll:           list.New(),
+		entries:      map[string]*list.Element{},
+		vary:         map[string]*varyIndex{},
+		tags:         map[string]map[string]bool{},
+		routes:       map[string]map[string]bool{},
+	}
+}
+
+// FromContext returns the cache that is handling the request, or nil.
+func FromContext(rctx *xroute.RouteContext) *Cache {
+	if rctx != nil {
+		if c, ok := rctx.Data[cacheKey{}].(*Cache); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// Tag returns an inline middleware that tags the entries of the route.
+func Tag(tags ...string) *xroute.Middleware {
+	return &xroute.Middleware{Handler: func(chain *xroute.ChainHandler) {
+		AddTags(chain.Context, tags...)
+		chain.Next()
+	}}
+}
+
+// AddTags tags the entry of the current response. It can be called by
+// handlers.
+func AddTags(rctx *xroute.RouteContext, tags ...string) {
+	old, _ := rctx.Data[tagsKey{}].([]string)
+	rctx.Data[tagsKey{}] = append(old, tags...)
+}
+
+// RouteName returns an inline middleware that names the route, so its
+// entries can be invalidated with InvalidateRoute.
+func RouteName(name string) *xroute.Middleware {
+	return &xroute.Middleware{Handler: func(chain *xroute.ChainHandler) {
+		chain.Context.Data[nameKey{}] = name
+		chain.Next()
+	}}
+}
+
+// Middleware returns the named response cache middleware. It must run after
+// routing: attach it with With, Group or HandlerIntersept.
+func (c *Cache) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: c.Handler}
+}
+
+// Handler is the response cache middleware handler.
+func (c *Cache) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	rctx.Data[cacheKey{}] = c
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		chain.Next()
+		return
+	}
+
+	baseKey := c.baseKey(r, rctx)
+	reqCC := parseCacheControl(r.Header.Get("Cache-Control"))
+	// responses of authenticated requests are per user: they are only
+	// shared if the response says so (RFC 9111, section 3.5)
+	authorized := r.Header.Get("Authorization") != ""
+
+	if _, noCache := reqCC["no-cache"]; !noCache {
+		if _, noStore := reqCC["no-store"]; !noStore {
+			if e := c.get(baseKey, r); e != nil && (!authorized || e.Shared) {
+				c.serve(chain.Writer, r, e)
+				return
+			}
+		}
+	}
+
+	// responses larger than MaxEntrySize, flushed or hijacked are streamed,
+	// and not stored
+	bw := xroute.NewBufferedWriter(chain.Writer, c.MaxEntrySize)
+	bw.Header().Set("X-Cache", "MISS")
+	defer bw.Commit()
+	chain.Next(bw)
+
+	if _, noStore := reqCC["no-store"]; noStore || !bw.Buffered() {
+		return
+	}
+
+	ttl, ok := c.ttl(bw.Status(), bw.Header())
+	if !ok {
+		return
+	}
+	shared := sharedResponse(bw.Header())
+	if authorized && !shared {
+		return
+	}
+
+	name, _ := rctx.Data[nameKey{}].(string)
+	tags, _ := rctx.Data[tagsKey{}].([]string)
+	now := c.now()
+	header := cloneHeader(bw.Header())
+	header.Del("X-Cache")
+
+	c.set(baseKey, r, &Entry{
+		Route:   name,
+		Tags:    tags,
+		Status:  bw.Status(),
+		Header:  header,
+		Body:    append([]byte{}, bw.Body()...),
+		Stored:  now,
+		Expires: now.Add(ttl),
+		Shared:  shared,
+	})
+}
+
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, e *Entry) {
+	header := w.Header()
+	for k, v := range e.Header {
+		header[k] = append([]string{}, v...)
+	}
+	header.Set("X-Cache", "HIT")
+	header.Set("Age", strconv.Itoa(int(c.now().Sub(e.Stored).Seconds())))
+	w.WriteHeader(e.Status)
+	if r.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+// baseKey returns the entry key without the Vary part. The params and the
+// extension are escaped, so they can't contain the separators of the parts.
+func (c *Cache) baseKey(r *http.Request, rctx *xroute.RouteContext) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(rctx.RoutePattern())
+	if rctx.URLParams != nil {
+		for _, v := range rctx.URLParams.Values {
+			b.WriteByte(' ')
+			b.WriteString(url.QueryEscape(*v.Key))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(*v.Value))
+		}
+	}
+	if rctx.ApiExt != "" {
+		b.WriteString(" ." + url.QueryEscape(rctx.ApiExt))
+	}
+	if q := r.URL.Query(); len(q) > 0 {
+		// Encode sorts by key
+		b.WriteString(" ?" + q.Encode())
+	}
+	return b.String()
+}
+
+func varyKey(baseKey string, names []string, r *http.Request) string {
+	if len(names) == 0 {
+		return baseKey
+	}
+	var b strings.Builder
+	b.WriteString(baseKey)
+	for _, name := range names {
+		b.WriteString(" " + name + ":" + strings.Join(r.Header[name], ","))
+	}
+	return b.String()
+}
+
+func (c *Cache) ttl(status int, header http.Header) (time.Duration, bool) {
+	switch status {
+	case 200, 203, 204, 300, 301, 404, 405, 410, 414, 501:
+	default:
+		return 0, false
+	}
+	if header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	for _, v := range header["Vary"] {
+		if strings.TrimSpace(v) == "*" {
+			return 0, false
+		}
+	}
+
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return 0, false
+		}
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if c.DefaultTTL > 0 {
+		return c.DefaultTTL, true
+	}
+	return 0, false
+}
+
+func (c *Cache) get(baseKey string, r *http.Request) *Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vi, ok := c.vary[baseKey]
+	if !ok {
+		return nil
+	}
+	el, ok := c.entries[varyKey(baseKey, vi.names, r)]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*Entry)
+	if !c.now().Before(e.Expires) {
+		c.remove(el)
+		return nil
+	}
+	c.ll.MoveToFront(el)
+	return e
+}
+
+func (c *Cache) set(baseKey string, r *http.Request, e *Entry) {
+	var names []string
+	for _, v := range e.Header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	e.Key = varyKey(baseKey, names, r)
+	e.baseKey = baseKey
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[e.Key]; ok {
+		c.remove(el)
+	}
+	vi, ok := c.vary[baseKey]
+	if !ok {
+		vi = &varyIndex{}
+		c.vary[baseKey] = vi
+	}
+	vi.names = names
+	vi.refs++
+	c.entries[e.Key] = c.ll.PushFront(e)
+	for _, tag := range e.Tags {
+		index(c.tags, tag, e.Key)
+	}
+	if e.Route != "" {
+		index(c.routes, e.Route, e.Key)
+	}
+
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.remove(c.ll.Back())
+	}
+}
+
+func index(m map[string]map[string]bool, name, key string) {
+	keys, ok := m[name]
+	if !ok {
+		keys = map[string]bool{}
+		m[name] = keys
+	}
+	keys[key] = true
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*Entry)
+	delete(c.entries, e.Key)
+	if vi := c.vary[e.baseKey]; vi != nil {
+		if vi.refs--; vi.refs <= 0 {
+			delete(c.vary, e.baseKey)
+		}
+	}
+	for _, tag := range e.Tags {
+		if keys := c.tags[tag]; keys != nil {
+			delete(keys, e.Key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+	if keys := c.routes[e.Route]; keys != nil {
+		delete(keys, e.Key)
+		if len(keys) == 0 {
+			delete(c.routes, e.Route)
+		}
+	}
+}
+
+func (c *Cache) invalidate(m map[string]map[string]bool, names []string) (count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		for key := range m[name] {
+			if el, ok := c.entries[key]; ok {
+				c.remove(el)
+				count++
+			}
+		}
+	}
+	return
+}
+
+// InvalidateTag removes the entries tagged with any of `tags` and returns
+// the number of removed entries.
+func (c *Cache) InvalidateTag(tags ...string) int {
+	return c.invalidate(c.tags, tags)
+}
+
+// InvalidateRoute removes the entries of the named routes and returns the
+// number of removed entries.
+func (c *Cache) InvalidateRoute(names ...string) int {
+	return c.invalidate(c.routes, names)
+}
+
+// Purge removes all entries.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.entries = map[string]*list.Element{}
+	c.vary = map[string]*varyIndex{}
+	c.tags = map[string]map[string]bool{}
+	c.routes = map[string]map[string]bool{}
+}
+
+// Len returns the number of entries.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// sharedResponse reports whether the response can be served to requests
+// with Authorization.
+func sharedResponse(header http.Header) bool {
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	_, public := cc["public"]
+	_, sMaxAge := cc["s-maxage"]
+	return public || sMaxAge
+}
+
+func parseCacheControl(value string) map[string]string {
+	cc := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, v := part, ""
+		if idx := strings.IndexByte(part, '='); idx >= 0 {
+			name, v = part[:idx], strings.Trim(part[idx+1:], `"`)
+		}
+		cc[strings.ToLower(name)] = v
+	}
+	return cc
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, v := range h {
+		h2[k] = append([]string{}, v...)
+	}
+	return h2
+}
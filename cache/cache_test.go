@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func testRequest(t *testing.T, ts *httptest.Server, method, path string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestETag(t *testing.T) {
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	r := xroute.NewRouter()
+	r.Group(func(r xroute.Router) {
+		r.Use(ETag())
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		})
+		r.Get("/lm", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("modified"))
+		})
+	})
+	r.With(ETag(ETagOptions{Weak: true, MaxSize: 4})).Get("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("too big"))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, "GET", "/", nil)
+	etag := resp.Header.Get("ETag")
+	if body != "hello" || etag != ComputeETag([]byte("hello"), false) || resp.Header.Get("Content-Length") != "5" {
+		t.Fatalf("unexpected response %q %v", body, resp.Header)
+	}
+
+	resp, body = testRequest(t, ts, "GET", "/", http.Header{"If-None-Match": {`"other", W/` + etag}})
+	if resp.StatusCode != http.StatusNotModified || body != "" || resp.Header.Get("ETag") != etag {
+		t.Fatalf("expected 304, got %d %q", resp.StatusCode, body)
+	}
+
+	if resp, _ = testRequest(t, ts, "GET", "/", http.Header{"If-None-Match": {`"other"`}}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	ims := lastModified.Add(time.Second).Format(http.TimeFormat)
+	if resp, _ = testRequest(t, ts, "GET", "/lm", http.Header{"If-Modified-Since": {ims}}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", resp.StatusCode)
+	}
+	ims = lastModified.Add(-time.Second).Format(http.TimeFormat)
+	if resp, _ = testRequest(t, ts, "GET", "/lm", http.Header{"If-Modified-Since": {ims}}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	if resp, body = testRequest(t, ts, "GET", "/big", nil); body != "too big" || resp.Header.Get("ETag") != "" {
+		t.Fatalf("expected streamed response without ETag: %q %v", body, resp.Header)
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := map[string]int{}
+	c := New(2)
+
+	user := func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		id := rctx.URLParam("id")
+		calls[id]++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "user %s %s #%d", id, r.Header.Get("Accept-Language"), calls[id])
+	}
+
+	r := xroute.NewRouter()
+	r.Group(func(r xroute.Router) {
+		r.Use(c.Middleware())
+		r.With(RouteName("users"), Tag("accounts")).Get("/users/{id}", user)
+		r.Get("/nostore", func(w http.ResponseWriter, r *http.Request) {
+			calls["nostore"]++
+			w.Header().Set("Cache-Control", "no-store")
+			fmt.Fprintf(w, "#%d", calls["nostore"])
+		})
+		r.Get("/tagged", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+			calls["tagged"]++
+			AddTags(rctx, "accounts")
+			w.Header().Set("Cache-Control", "s-maxage=10, max-age=0")
+			fmt.Fprintf(w, "#%d", calls["tagged"])
+		})
+	})
+	r.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		c.InvalidateRoute("users")
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	expect := func(path string, header http.Header, body, xcache string) {
+		t.Helper()
+		resp, b := testRequest(t, ts, "GET", path, header)
+		if b != body || resp.Header.Get("X-Cache") != xcache {
+			t.Fatalf("GET %s: expected %q (%s), got %q (%s)", path, body, xcache, b, resp.Header.Get("X-Cache"))
+		}
+	}
+
+	en, pt := http.Header{"Accept-Language": {"en"}}, http.Header{"Accept-Language": {"pt"}}
+
+	expect("/users/1", en, "user 1 en #1", "MISS")
+	expect("/users/1", en, "user 1 en #1", "HIT")
+	expect("/users/1", pt, "user 1 pt #2", "MISS")
+	expect("/users/1", pt, "user 1 pt #2", "HIT")
+	expect("/users/1?a=1", en, "user 1 en #3", "MISS")
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries (LRU), got %d", c.Len())
+	}
+	expect("/users/1", pt, "user 1 pt #2", "HIT")
+	expect("/users/1", en, "user 1 en #4", "MISS")
+	expect("/users/1", http.Header{"Accept-Language": {"en"}, "Cache-Control": {"no-cache"}}, "user 1 en #5", "MISS")
+
+	testRequest(t, ts, "POST", "/users/1", nil)
+	if c.Len() != 0 {
+		t.Fatalf("expected route invalidation, got %d entries", c.Len())
+	}
+
+	expect("/nostore", nil, "#1", "MISS")
+	expect("/nostore", nil, "#2", "MISS")
+
+	expect("/tagged", nil, "#1", "MISS")
+	expect("/users/2", en, "user 2 en #1", "MISS")
+	expect("/tagged", nil, "#1", "HIT")
+	if n := c.InvalidateTag("accounts"); n != 2 {
+		t.Fatalf("expected 2 invalidated entries, got %d", n)
+	}
+	expect("/tagged", nil, "#2", "MISS")
+
+	now := time.Now()
+	c.now = func() time.Time { return now.Add(time.Minute) }
+	expect("/tagged", nil, "#3", "MISS")
+}
+
+func TestCacheAuthorization(t *testing.T) {
+	c := New(10)
+	r := xroute.NewRouter()
+	r.Group(func(r xroute.Router) {
+		r.Use(c.Middleware())
+		r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			fmt.Fprint(w, r.Header.Get("Authorization"))
+		})
+		r.Get("/catalog", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			fmt.Fprint(w, "catalog for "+r.Header.Get("Authorization"))
+		})
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	expect := func(path, token, body, xcache string) {
+		t.Helper()
+		resp, b := testRequest(t, ts, "GET", path, http.Header{"Authorization": {"Bearer " + token}})
+		if b != body || resp.Header.Get("X-Cache") != xcache {
+			t.Fatalf("GET %s as %s: expected %q (%s), got %q (%s)", path, token, body, xcache, b, resp.Header.Get("X-Cache"))
+		}
+	}
+
+	expect("/me", "ann", "Bearer ann", "MISS")
+	expect("/me", "bob", "Bearer bob", "MISS")
+	expect("/me", "ann", "Bearer ann", "MISS")
+	if c.Len() != 0 {
+		t.Fatalf("expected private responses not stored, got %d entries", c.Len())
+	}
+
+	expect("/catalog", "ann", "catalog for Bearer ann", "MISS")
+	expect("/catalog", "bob", "catalog for Bearer ann", "HIT")
+}
+
+func TestCacheKeyParams(t *testing.T) {
+	c := New(10)
+	r := xroute.NewRouter()
+	r.With(c.Middleware()).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "user %q ?%s", rctx.URLParam("id"), r.URL.RawQuery)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	// a param value with the query separator of the key
+	if _, b := testRequest(t, ts, "GET", "/users/1%20%3Fa=b", nil); b != `user "1 ?a=b" ?` {
+		t.Fatalf("unexpected response %q", b)
+	}
+	resp, b := testRequest(t, ts, "GET", "/users/1?a=b", nil)
+	if b != `user "1" ?a=b` || resp.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("expected own entry, got %q (%s)", b, resp.Header.Get("X-Cache"))
+	}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// ETagName is the name of the ETag middleware.
+const ETagName = "etag"
+
+// DefaultETagMaxSize is the default maximum size of a buffered response. Bigger
+// responses are streamed without ETag.
+const DefaultETagMaxSize = 1 << 20
+
+// ETagOptions configures the ETag middleware.
+type ETagOptions struct {
+	// Weak generates weak validators (`W/"..."`), cheaper to compute.
+	Weak bool
+
+	// MaxSize is the maximum size of a buffered response. Zero means
+	// DefaultETagMaxSize.
+	MaxSize int
+}
+
+// ETag returns the named middleware that buffers GET and HEAD responses to
+// compute their ETag, unless the handler sets it, and answers conditional
+// requests (`If-None-Match` and `If-Modified-Since`) with 304 Not Modified.
+func ETag(opts ...ETagOptions) *xroute.Middleware {
+	var o ETagOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxSize == 0 {
+		o.MaxSize = DefaultETagMaxSize
+	}
+
+	return &xroute.Middleware{Name: ETagName, Handler: func(chain *xroute.ChainHandler) {
+		r := chain.Request()
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			chain.Next()
+			return
+		}
+
+		bw := xroute.NewBufferedWriter(chain.Writer, o.MaxSize)
+		defer bw.Commit()
+		chain.Next(bw)
+		if !bw.Buffered() {
+			return
+		}
+
+		header := bw.Header()
+		if bw.Status() == http.StatusOK {
+			etag := header.Get("ETag")
+			if etag == "" {
+				etag = ComputeETag(bw.Body(), o.Weak)
+				header.Set("ETag", etag)
+			}
+
+			if NotModified(r, header) {
+				bw.Reset()
+				writeNotModified(bw)
+				return
+			}
+			if header.Get("Content-Length") == "" {
+				header.Set("Content-Length", strconv.Itoa(len(bw.Body())))
+			}
+		}
+	}}
+}
+
+// ComputeETag returns the quoted entity tag of `body`.
+func ComputeETag(body []byte, weak bool) string {
+	if weak {
+		h := fnv.New64a()
+		h.Write(body)
+		return `W/"` + strconv.FormatUint(h.Sum64(), 16) + "-" + strconv.Itoa(len(body)) + `"`
+	}
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified evaluates the `If-None-Match` and `If-Modified-Since`
+// request preconditions against the response `header`, as defined by RFC
+// 7232. It returns true if the response should be 304 Not Modified.
+func NotModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagWeakMatch(inm, header.Get("ETag"))
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	lm := header.Get("Last-Modified")
+	if ims == "" || lm == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lm)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+func etagWeakMatch(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	if h.Get("Etag") != "" {
+		delete(h, "Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
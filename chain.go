@@ -41,19 +41,26 @@ func (c *ChainHandler) ServeHTTPContext(w http.ResponseWriter, r *http.Request,
 		rctx = NewRouteContext()
 	}
 
-	if eh, ok := c.Endpoint.(*EndpointHandler); ok {
-		if ehh := eh.find(r.Header); ehh == nil {
-			w.WriteHeader(http.StatusBadRequest)
+	endpoint := c.Endpoint
+	if eh, ok := endpoint.(*EndpointHandler); ok {
+		if v := eh.find(r, rctx); v == nil {
+			serveConstraintMismatch(w, r, rctx)
 			return
 		} else {
-			c.Endpoint = ehh.handler
+			endpoint = v.handler
+			rctx.setEndpoint(v)
 		}
 	}
-	rctx.Handler = c.Endpoint
-	copy := &ChainHandler{Middlewares: c.Middlewares, Endpoint: c.Endpoint, Context: rctx, request: r, Writer: NewResponseWriter(w)}
+	rctx.Handler = endpoint
+	copy := &ChainHandler{Middlewares: c.Middlewares, Endpoint: endpoint, Context: rctx, request: r, Writer: NewResponseWriter(w)}
 	copy.Next()
 }
 
+func (c *ChainHandler) call(md *Middleware) {
+	defer c.Context.begin(StepMiddleware, md, c.Writer, c.request)()
+	md.Handler(c)
+}
+
 func (c *ChainHandler) Request() *http.Request {
 	return c.request
 }
@@ -102,12 +109,12 @@ func (c *ChainHandler) Next(values ...interface{}) {
 
 	for {
 		if c.Index < len(c.Middlewares) {
-			h := c.Middlewares[c.Index].Handler
+			md := c.Middlewares[c.Index]
 			c.Index++
-			h(c)
+			c.call(md)
 		} else if c.Index == len(c.Middlewares) {
 			c.Index++
-			c.Endpoint.ServeHTTPContext(c.Writer, c.request, c.Context)
+			serveEndpoint(c.Endpoint, c.Writer, c.request, c.Context)
 		}
 		if c.next {
 			c.next = false
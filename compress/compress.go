@@ -0,0 +1,350 @@
+// Package compress implements a response compression middleware for xroute.
+//
+// The encoding is negotiated with the `Accept-Encoding` request header among
+// the registered encoders (gzip and deflate by default, others such as
+// brotli can be plugged with Compressor.SetEncoder). Responses are
+// compressed only if their content type is allowed and their size reaches
+// the minimum size.
+//
+// Routes can disable or tune compression through inline middlewares:
+//
+//	r.Use(compress.New(5).Middleware())
+//	r.With(compress.Disable).Get("/download", download)
+//	r.With(compress.Route(compress.Policy{MinSize: 64})).Get("/small", small)
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the compression middleware.
+const Name = "compress"
+
+// DefaultMinSize is the default minimum response size to compress.
+const DefaultMinSize = 1024
+
+// DefaultContentTypes is the default content types allow-list.
+var DefaultContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"text/xml",
+	"application/javascript",
+	"application/x-javascript",
+	"application/json",
+	"application/xml",
+	"application/atom+xml",
+	"application/rss+xml",
+	"image/svg+xml",
+}
+
+// EncoderFunc returns a writer that compresses into `w` with the given
+// compression level. If the returned writer implements
+// `Reset(io.Writer)`, it is pooled and reused.
+type EncoderFunc func(w io.Writer, level int) io.WriteCloser
+
+// Policy is the compression policy of a route. Zero values use the
+// Compressor defaults.
+type Policy struct {
+	// Disabled disables compression.
+	Disabled bool
+
+	// Level is the compression level.
+	Level int
+
+	// MinSize is the minimum response size to compress.
+	MinSize int
+
+	// ContentTypes is the content types allow-list.
+	ContentTypes []string
+
+	// Encodings restricts the negotiable encodings.
+	Encodings []string
+}
+
+type policyKey struct{}
+
+// Disable is an inline middleware that disables compression of the route
+// responses.
+var Disable = Route(Policy{Disabled: true})
+
+// Route returns an inline middleware that sets the compression policy of
+// the route.
+func Route(policy Policy) *xroute.Middleware {
+	return &xroute.Middleware{Handler: func(chain *xroute.ChainHandler) {
+		chain.Context.Data[policyKey{}] = &policy
+		chain.Next()
+	}}
+}
+
+func policyOf(rctx *xroute.RouteContext) *Policy {
+	if rctx != nil {
+		if p, ok := rctx.Data[policyKey{}].(*Policy); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// Compressor negotiates the response encoding and compresses the response
+// bodies.
+type Compressor struct {
+	level    int
+	minSize  int
+	types    contentTypes
+	encoders map[string]EncoderFunc
+	// encoding names in precedence order
+	precedence []string
+
+	mu    sync.Mutex
+	pools map[poolKey]*sync.Pool
+}
+
+type poolKey struct {
+	encoding string
+	level    int
+}
+
+// New returns a new Compressor with gzip and deflate encoders. If `types` is
+// empty, DefaultContentTypes is used. Content types ending with `/*` match
+// any subtype.
+func New(level int, types ...string) *Compressor {
+	if len(types) == 0 {
+		types = DefaultContentTypes
+	}
+	c := &Compressor{
+		level:    level,
+		minSize:  DefaultMinSize,
+		types:    newContentTypes(types),
+		encoders: map[string]EncoderFunc{},
+		pools:    map[poolKey]*sync.Pool{},
+	}
+	c.SetEncoder("deflate", encoderDeflate)
+	c.SetEncoder("gzip", encoderGzip)
+	return c
+}
+
+// SetMinSize sets the minimum response size to compress.
+func (c *Compressor) SetMinSize(size int) *Compressor {
+	c.minSize = size
+	return c
+}
+
+// SetEncoder registers an encoder, or replaces an existing one. New encoders
+// take precedence over the already registered ones, for example:
+//
+//	c.SetEncoder("br", func(w io.Writer, level int) io.WriteCloser {
+//		return brotli.NewWriterLevel(w, level)
+//	})
+func (c *Compressor) SetEncoder(encoding string, fn EncoderFunc) *Compressor {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		panic("compress: encoding name is empty")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, e := range c.precedence {
+		if e == encoding {
+			c.precedence = append(c.precedence[:i], c.precedence[i+1:]...)
+			break
+		}
+	}
+	for key := range c.pools {
+		if key.encoding == encoding {
+			delete(c.pools, key)
+		}
+	}
+	c.encoders[encoding] = fn
+	c.precedence = append([]string{encoding}, c.precedence...)
+	return c
+}
+
+// Encodings returns the registered encodings in precedence order.
+func (c *Compressor) Encodings() []string {
+	return append([]string{}, c.precedence...)
+}
+
+// Middleware returns the named compression middleware.
+func (c *Compressor) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: c.Handler}
+}
+
+// Handler is the compression middleware handler.
+func (c *Compressor) Handler(chain *xroute.ChainHandler) {
+	r := chain.Request()
+	accepted := c.accepted(r.Header.Get("Accept-Encoding"))
+	if len(accepted) == 0 || r.Method == http.MethodHead {
+		chain.Next()
+		return
+	}
+
+	cw := &ResponseWriter{
+		ResponseWriter: chain.Writer,
+		compressor:     c,
+		rctx:           chain.Context,
+		accepted:       accepted,
+	}
+	if chain.Context != nil {
+		chain.Context.Data[writerKey{}] = cw
+	}
+	defer cw.Close()
+	chain.Next(xroute.ResponseWriter(cw))
+}
+
+// accepted returns the encodings accepted by the client, ordered by quality
+// and server precedence.
+func (c *Compressor) accepted(header string) (encodings []string) {
+	if header == "" {
+		return
+	}
+
+	quality := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseCoding(part)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			wildcard = q
+		} else {
+			quality[name] = q
+		}
+	}
+
+	type candidate struct {
+		name string
+		q    float64
+	}
+	var candidates []candidate
+	for _, name := range c.precedence {
+		q, ok := quality[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{name, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, cd := range candidates {
+		encodings = append(encodings, cd.name)
+	}
+	return
+}
+
+func parseCoding(s string) (name string, q float64) {
+	q = 1
+	parts := strings.Split(s, ";")
+	name = strings.ToLower(strings.TrimSpace(parts[0]))
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "q=") {
+			if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return
+}
+
+func (c *Compressor) newWriter(encoding string, level int, w io.Writer) io.WriteCloser {
+	c.mu.Lock()
+	pool := c.pools[poolKey{encoding, level}]
+	fn := c.encoders[encoding]
+	c.mu.Unlock()
+
+	if pool != nil {
+		if enc, ok := pool.Get().(io.WriteCloser); ok {
+			enc.(resetter).Reset(w)
+			return enc
+		}
+	}
+
+	return fn(w, level)
+}
+
+func (c *Compressor) release(encoding string, level int, enc io.WriteCloser) {
+	if _, ok := enc.(resetter); !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := poolKey{encoding, level}
+	pool := c.pools[key]
+	if pool == nil {
+		pool = &sync.Pool{}
+		c.pools[key] = pool
+	}
+	pool.Put(enc)
+}
+
+type resetter interface {
+	Reset(w io.Writer)
+}
+
+type flusher interface {
+	Flush() error
+}
+
+func encoderGzip(w io.Writer, level int) io.WriteCloser {
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil
+	}
+	return gw
+}
+
+func encoderDeflate(w io.Writer, level int) io.WriteCloser {
+	dw, err := flate.NewWriter(w, level)
+	if err != nil {
+		return nil
+	}
+	return dw
+}
+
+type contentTypes struct {
+	exact    map[string]bool
+	wildcard map[string]bool
+}
+
+func newContentTypes(types []string) contentTypes {
+	ct := contentTypes{exact: map[string]bool{}, wildcard: map[string]bool{}}
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if strings.HasSuffix(t, "/*") {
+			ct.wildcard[strings.TrimSuffix(t, "/*")] = true
+		} else {
+			ct.exact[t] = true
+		}
+	}
+	return ct
+}
+
+func (ct contentTypes) allowed(contentType string) bool {
+	if idx := strings.IndexByte(contentType, ';'); idx >= 0 {
+		contentType = contentType[:idx]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if ct.exact[contentType] {
+		return true
+	}
+	if idx := strings.IndexByte(contentType, '/'); idx > 0 {
+		return ct.wildcard[contentType[:idx]]
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+var bigText = strings.Repeat("compress me please. ", 200)
+
+func testRequest(t *testing.T, ts *httptest.Server, path, acceptEncoding string) (*http.Response, []byte) {
+	req, err := http.NewRequest("GET", ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompress(t *testing.T) {
+	var raw, encoded int
+	var rawTee, wireTee bytes.Buffer
+
+	text := func(body string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(body))
+		}
+	}
+
+	r := xroute.NewRouter()
+	r.Use(&xroute.Middleware{Name: "wire-tee", Before: []string{Name}, Handler: func(chain *xroute.ChainHandler) {
+		chain.Writer.(xroute.WrapResponseWriter).Tee(&wireTee)
+		chain.Next()
+	}})
+	r.Use(&xroute.Middleware{Name: "stats", Before: []string{Name}, Handler: func(chain *xroute.ChainHandler) {
+		chain.Next()
+		if cw := WriterOf(chain.Context); cw != nil {
+			raw, encoded = cw.RawBytesWritten(), cw.EncodedBytesWritten()
+		}
+	}})
+	r.Use(New(5).Middleware())
+	r.With(func(chain *xroute.ChainHandler) {
+		chain.Writer.(xroute.WrapResponseWriter).Tee(&rawTee)
+		chain.Next()
+	}).Get("/big", text(bigText))
+	r.Get("/small", text("small"))
+	r.Get("/png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(bigText))
+	})
+	r.With(Disable).Get("/disabled", text(bigText))
+	r.With(Route(Policy{MinSize: 2, Encodings: []string{"deflate"}})).Get("/policy", text("tiny"))
+	r.Get("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("part1"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("part2"))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, body := testRequest(t, ts, "/big", "gzip")
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("unexpected headers %v", resp.Header)
+	}
+	if decode(t, "gzip", body) != bigText {
+		t.Fatal("bad gzip body")
+	}
+	if raw != len(bigText) || encoded != len(body) || encoded >= raw {
+		t.Fatalf("unexpected byte counts raw=%d encoded=%d body=%d", raw, encoded, len(body))
+	}
+	if rawTee.String() != bigText || !bytes.Equal(wireTee.Bytes(), body) {
+		t.Fatal("unexpected tee'd data")
+	}
+
+	if resp, body = testRequest(t, ts, "/big", "gzip;q=0.5, deflate"); resp.Header.Get("Content-Encoding") != "deflate" {
+		t.Fatalf("expected deflate, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	if decode(t, "deflate", body) != bigText {
+		t.Fatal("bad deflate body")
+	}
+
+	if resp, body = testRequest(t, ts, "/big", "identity"); resp.Header.Get("Content-Encoding") != "" || string(body) != bigText {
+		t.Fatal("unexpected compression")
+	}
+
+	for _, path := range []string{"/small", "/png", "/disabled"} {
+		if resp, _ = testRequest(t, ts, path, "gzip"); resp.Header.Get("Content-Encoding") != "" {
+			t.Fatalf("%s: unexpected compression", path)
+		}
+	}
+	if resp, _ = testRequest(t, ts, "/disabled", "gzip"); resp.Header.Get("Vary") != "" {
+		t.Fatal("unexpected Vary header on disabled route")
+	}
+
+	if resp, body = testRequest(t, ts, "/policy", "gzip, deflate"); resp.Header.Get("Content-Encoding") != "deflate" || decode(t, "deflate", body) != "tiny" {
+		t.Fatalf("policy not applied: %v", resp.Header)
+	}
+
+	if resp, body = testRequest(t, ts, "/stream", "gzip"); resp.Header.Get("Content-Encoding") != "gzip" || decode(t, "gzip", body) != "part1part2" {
+		t.Fatalf("bad streamed response: %v", resp.Header)
+	}
+}
+
+type prefixEncoder struct {
+	w io.Writer
+}
+
+func (e *prefixEncoder) Write(p []byte) (int, error) { return e.w.Write(bytes.ToUpper(p)) }
+func (e *prefixEncoder) Close() error                { return nil }
+
+func TestCompressCustomEncoder(t *testing.T) {
+	c := New(5).SetMinSize(1)
+	c.SetEncoder("upper", func(w io.Writer, level int) io.WriteCloser {
+		return &prefixEncoder{w}
+	})
+
+	if e := c.Encodings(); strings.Join(e, ",") != "upper,gzip,deflate" {
+		t.Fatalf("unexpected precedence %v", e)
+	}
+	if a := c.accepted("gzip, *;q=0.1, deflate;q=0"); strings.Join(a, ",") != "gzip,upper" {
+		t.Fatalf("unexpected negotiation %v", a)
+	}
+
+	r := xroute.NewRouter()
+	r.Use(c.Middleware())
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("hello"))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	if resp, body := testRequest(t, ts, "/", "gzip, upper"); resp.Header.Get("Content-Encoding") != "upper" || string(body) != "HELLO" {
+		t.Fatalf("unexpected response %q %v", body, resp.Header)
+	}
+}
@@ -0,0 +1,317 @@
+package compress
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+type writerKey struct{}
+
+// WriterOf returns the compression ResponseWriter of the request, or nil if
+// the response is not handled by the compression middleware.
+func WriterOf(rctx *xroute.RouteContext) *ResponseWriter {
+	if rctx != nil {
+		if w, ok := rctx.Data[writerKey{}].(*ResponseWriter); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+// ResponseWriter compresses the response body. The compression decision is
+// deferred until the minimum size is buffered, the response is flushed or
+// the handler returns.
+//
+// BytesWritten returns the number of uncompressed (raw) bytes written by the
+// handler and EncodedBytesWritten the number of bytes sent to the proxied
+// writer. The io.Writer set with Tee receives the raw bytes; a Tee on the
+// proxied writer receives the encoded bytes.
+type ResponseWriter struct {
+	xroute.ResponseWriter
+
+	compressor *Compressor
+	rctx       *xroute.RouteContext
+	accepted   []string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	closed      bool
+	hijacked    bool
+
+	encoding string
+	level    int
+	enc      io.WriteCloser
+	buf      []byte
+
+	raw     int
+	encoded int
+	tee     io.Writer
+}
+
+// Encoding returns the selected content encoding, or empty if the response is
+// not compressed.
+func (cw *ResponseWriter) Encoding() string {
+	return cw.encoding
+}
+
+func (cw *ResponseWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+
+	if !bodyAllowed(code) {
+		cw.decide(false)
+		return
+	}
+	if cl := cw.Header().Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil {
+			cw.decide(n >= cw.minSize())
+		}
+	}
+}
+
+func (cw *ResponseWriter) Write(p []byte) (n int, err error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	cw.raw += len(p)
+	if cw.tee != nil {
+		cw.tee.Write(p)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) >= cw.minSize() {
+			if err = cw.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.writeRaw(p)
+}
+
+func (cw *ResponseWriter) writeRaw(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.encoded += n
+	return n, err
+}
+
+// Flush compresses and sends the buffered data. The compression decision is
+// taken at the first flush, regardless of the minimum size.
+func (cw *ResponseWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if f, ok := cw.enc.(flusher); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close flushes the remaining data and closes the encoder. It is called by
+// the middleware after the chain returns.
+func (cw *ResponseWriter) Close() error {
+	if cw.closed || cw.hijacked {
+		return nil
+	}
+	cw.closed = true
+
+	if !cw.wroteHeader {
+		// nothing was written
+		return nil
+	}
+	if !cw.decided {
+		if err := cw.decide(len(cw.buf) >= cw.minSize()); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		err := cw.enc.Close()
+		cw.compressor.release(cw.encoding, cw.level, cw.enc)
+		cw.enc = nil
+		return err
+	}
+	return nil
+}
+
+// Hijack disables the compression and hijacks the proxied writer.
+func (cw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := xroute.HijackResponseWriter(cw.ResponseWriter)
+	if err == nil {
+		cw.hijacked = true
+		cw.decided = true
+		cw.wroteHeader = true
+		cw.status = http.StatusSwitchingProtocols
+		cw.buf = nil
+		cw.tee = nil
+	}
+	return conn, rw, err
+}
+
+func (cw *ResponseWriter) Status() int {
+	return cw.status
+}
+
+func (cw *ResponseWriter) HasStatus(status ...int) bool {
+	for _, s := range status {
+		if cw.status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// BytesWritten returns the number of raw bytes written by the handler.
+func (cw *ResponseWriter) BytesWritten() int {
+	return cw.raw
+}
+
+// RawBytesWritten is an alias of BytesWritten.
+func (cw *ResponseWriter) RawBytesWritten() int {
+	return cw.raw
+}
+
+// EncodedBytesWritten returns the number of bytes written to the proxied
+// writer, after compression.
+func (cw *ResponseWriter) EncodedBytesWritten() int {
+	return cw.encoded
+}
+
+// Tee sets the writer that receives a copy of the raw (uncompressed) body.
+func (cw *ResponseWriter) Tee(w io.Writer) {
+	cw.tee = w
+}
+
+// Unwrap returns the proxied writer.
+func (cw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *ResponseWriter) policy() *Policy {
+	return policyOf(cw.rctx)
+}
+
+func (cw *ResponseWriter) minSize() int {
+	if p := cw.policy(); p != nil && p.MinSize != 0 {
+		return p.MinSize
+	}
+	return cw.compressor.minSize
+}
+
+// decide selects the encoding, sends the header and the buffered data.
+func (cw *ResponseWriter) decide(sizeOk bool) (err error) {
+	cw.decided = true
+	header := cw.Header()
+	p := cw.policy()
+
+	if p == nil || !p.Disabled {
+		if cw.contentTypeAllowed(header, p) {
+			header.Add("Vary", "Accept-Encoding")
+			if sizeOk && bodyAllowed(cw.status) && header.Get("Content-Encoding") == "" {
+				cw.encoding = cw.selectEncoding(p)
+			}
+		}
+	}
+
+	if cw.encoding != "" {
+		cw.level = cw.compressor.level
+		if p != nil && p.Level != 0 {
+			cw.level = p.Level
+		}
+		cw.enc = cw.compressor.newWriter(cw.encoding, cw.level, writerFunc(cw.writeRaw))
+		if cw.enc == nil {
+			cw.encoding = ""
+		} else {
+			header.Set("Content-Encoding", cw.encoding)
+			header.Del("Content-Length")
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) > 0 {
+		buf := cw.buf
+		cw.buf = nil
+		if cw.enc != nil {
+			_, err = cw.enc.Write(buf)
+		} else {
+			_, err = cw.writeRaw(buf)
+		}
+	}
+	return
+}
+
+func (cw *ResponseWriter) contentTypeAllowed(header http.Header, p *Policy) bool {
+	ct := header.Get("Content-Type")
+	if ct == "" {
+		if len(cw.buf) == 0 {
+			return false
+		}
+		// same as net/http does on first write
+		ct = http.DetectContentType(cw.buf)
+		header.Set("Content-Type", ct)
+	}
+	if p != nil && len(p.ContentTypes) > 0 {
+		return newContentTypes(p.ContentTypes).allowed(ct)
+	}
+	return cw.compressor.types.allowed(ct)
+}
+
+func (cw *ResponseWriter) selectEncoding(p *Policy) string {
+	for _, e := range cw.accepted {
+		if p == nil || len(p.Encodings) == 0 {
+			return e
+		}
+		for _, pe := range p.Encodings {
+			if strings.EqualFold(pe, e) {
+				return e
+			}
+		}
+	}
+	return ""
+}
+
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+var (
+	_ xroute.WrapResponseWriter = &ResponseWriter{}
+	_ http.Flusher              = &ResponseWriter{}
+	_ http.Hijacker             = &ResponseWriter{}
+)
@@ -0,0 +1,208 @@
+package xroute
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Predicate is a named request condition of an endpoint handler. The name
+// identifies the predicate in route dumps and duplicate checks.
+type Predicate struct {
+	Name  string
+	Match func(r *http.Request, rctx *RouteContext) bool
+}
+
+// Constraints are the request conditions of an endpoint handler, besides
+// the method and the path. A handler is selected only if all of them match.
+// For the header, query and cookie constraints, any of the values of a key
+// matches. The version matches requests of the same or a later API version
+// (see Router.Version).
+//
+// When many handlers of an endpoint match, the most specific one wins: the
+// one with more constraints, then the one with more header, query, cookie
+// and version constraints over predicates, then the one of the latest
+// version, then the first registered.
+type Constraints struct {
+	Header     http.Header
+	Query      url.Values
+	Cookie     url.Values
+	Version    string
+	Predicates []*Predicate
+}
+
+// IsZero reports whether there are no constraints.
+func (c Constraints) IsZero() bool {
+	return c.Len() == 0
+}
+
+// Len returns the number of constraints.
+func (c Constraints) Len() int {
+	return c.values() + len(c.Predicates)
+}
+
+func (c Constraints) values() int {
+	n := len(c.Header) + len(c.Query) + len(c.Cookie)
+	if c.Version != "" {
+		n++
+	}
+	return n
+}
+
+// Match reports whether the request matches all the constraints. Versions
+// and predicates never match without a route context.
+func (c Constraints) Match(r *http.Request, rctx *RouteContext) bool {
+	if c.Version != "" {
+		if rctx == nil || (rctx.APIVersion != "" && CompareVersions(c.Version, rctx.APIVersion) > 0) {
+			return false
+		}
+	}
+	for name, values := range c.Header {
+		if !containsString(values, r.Header.Get(name)) {
+			return false
+		}
+	}
+	if len(c.Query) > 0 {
+		query := r.URL.Query()
+		for name, values := range c.Query {
+			if !containsString(values, query.Get(name)) {
+				return false
+			}
+		}
+	}
+	for name, values := range c.Cookie {
+		cookie, err := r.Cookie(name)
+		if err != nil || !containsString(values, cookie.Value) {
+			return false
+		}
+	}
+	for _, p := range c.Predicates {
+		if rctx == nil || !p.Match(r, rctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equal reports whether the constraints are the same. Predicates are
+// compared by name.
+func (c Constraints) Equal(o Constraints) bool {
+	if c.Version != o.Version || len(c.Predicates) != len(o.Predicates) {
+		return false
+	}
+	for i, p := range c.Predicates {
+		if p.Name != o.Predicates[i].Name {
+			return false
+		}
+	}
+	return valuesEqual(c.Header, o.Header) && valuesEqual(c.Query, o.Query) && valuesEqual(c.Cookie, o.Cookie)
+}
+
+// Merge returns the constraints with the `o` constraints added. Keys and the
+// version of `o` replace the ones of `c`.
+func (c Constraints) Merge(o Constraints) Constraints {
+	m := Constraints{
+		Header:     http.Header(mergeValues(c.Header, o.Header)),
+		Query:      url.Values(mergeValues(c.Query, o.Query)),
+		Cookie:     url.Values(mergeValues(c.Cookie, o.Cookie)),
+		Version:    c.Version,
+		Predicates: append(append([]*Predicate(nil), c.Predicates...), o.Predicates...),
+	}
+	if o.Version != "" {
+		m.Version = o.Version
+	}
+	return m
+}
+
+// String returns the sorted constraints, as shown in route dumps:
+//
+//	[Accept=application/json|text/json ?format=csv cookie:beta=1 version:2 if:admin]
+func (c Constraints) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	var items []string
+	items = append(items, formatValues("", c.Header)...)
+	items = append(items, formatValues("?", c.Query)...)
+	items = append(items, formatValues("cookie:", c.Cookie)...)
+	if c.Version != "" {
+		items = append(items, "version:"+c.Version)
+	}
+	for _, p := range c.Predicates {
+		items = append(items, "if:"+p.Name)
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+// moreSpecific reports whether `c` wins over `o` when both match.
+func (c Constraints) moreSpecific(o Constraints) bool {
+	if cl, ol := c.Len(), o.Len(); cl != ol {
+		return cl > ol
+	}
+	if cv, ov := c.values(), o.values(); cv != ov {
+		return cv > ov
+	}
+	return CompareVersions(c.Version, o.Version) > 0
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func valuesEqual(a, b map[string][]string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func mergeValues(a, b map[string][]string) map[string][]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	m := make(map[string][]string, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
+
+func formatValues(prefix string, values map[string][]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = prefix + k + "=" + strings.Join(values[k], "|")
+	}
+	return keys
+}
+
+// constraintMismatchHandler is a helper function to respond with a 400, bad
+// request, when the request matches no endpoint handler constraints.
+var constraintMismatchHandler = HttpHandler(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusBadRequest)
+})
+
+// serveConstraintMismatch serves the constraint mismatch handler of the
+// current router of `rctx`.
+func serveConstraintMismatch(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+	var h ContextHandler = constraintMismatchHandler
+	if rctx != nil {
+		if mx, ok := rctx.Router().(interface{ ConstraintMismatchHandler() ContextHandler }); ok {
+			h = mx.ConstraintMismatchHandler()
+		}
+	}
+	h.ServeHTTPContext(w, r, rctx)
+}
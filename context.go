@@ -47,13 +47,49 @@ type RouteContext struct {
 	// methodNotAllowed hint
 	methodNotAllowed bool
 
+	// rewritten reports whether the route path is the target of a rewrite
+	// rule, and rewrittenRaw whether that target is routed escaped, like the
+	// path of a request with a raw path (see Rules).
+	rewritten, rewrittenRaw bool
+
 	DefaultValueKey     interface{}
 	Data                map[interface{}]interface{}
 	RequestSetters      map[interface{}]RequestSetter
 	ChainRequestSetters map[interface{}]ChainRequestSetter
 	Handler             interface{}
-	RouterStack         []Router
-	Log                 logging.Logger
+	// EndpointHeaders are the header constraints of the matched endpoint
+	// handler (see Router.Headers).
+	EndpointHeaders http.Header
+	RouterStack     []Router
+	Log             logging.Logger
+
+	// Observers are notified of the request handling steps.
+	Observers []Observer
+
+	// EndpointConstraints are the constraints of the matched endpoint
+	// handler (see Router.Constrain).
+	EndpointConstraints Constraints
+
+	// APIVersion is the requested API version (see Router.Version).
+	APIVersion string
+
+	// Meta is the metadata of the matched endpoint handler, merged down from
+	// the routers (see Meta).
+	Meta Meta
+
+	// ClientIP, Scheme and Host are the client IP address, the scheme and
+	// the host of the request, as sent to the trusted proxies (see
+	// TrustedProxies).
+	ClientIP string
+	Scheme   string
+	Host     string
+
+	// Forwarded reports whether the request came from a trusted proxy, so
+	// Scheme and Host were resolved from its forwarding headers.
+	Forwarded bool
+
+	// RequestID is the ID of the request (see RequestIDs).
+	RequestID string
 
 	ApiExt string
 }
@@ -104,9 +140,65 @@ func (x *RouteContext) Reset() {
 	x.routeParams.Keys = x.routeParams.Keys[:0]
 	x.routeParams.Values = x.routeParams.Values[:0]
 	x.methodNotAllowed = false
+	x.rewritten, x.rewrittenRaw = false, false
 	x.Data = make(map[interface{}]interface{})
 	x.RequestSetters = make(map[interface{}]RequestSetter)
 	x.ChainRequestSetters = make(map[interface{}]ChainRequestSetter)
+	x.Observers = nil
+	x.EndpointHeaders = nil
+	x.EndpointConstraints = Constraints{}
+	x.APIVersion = ""
+	x.Meta = nil
+	x.ClientIP = ""
+	x.Scheme = ""
+	x.Host = ""
+	x.Forwarded = false
+	x.RequestID = ""
+}
+
+// resolveClient sets the client IP, scheme and host of the request, if not
+// set yet.
+func (x *RouteContext) resolveClient(r *http.Request, proxies *TrustedProxies) {
+	if x.ClientIP == "" {
+		x.ClientIP, x.Scheme, x.Host = proxies.Resolve(r)
+		x.Forwarded = proxies.Trusted(hostOnly(r.RemoteAddr))
+	}
+}
+
+// resolveRequestID sets the request ID of the request and echoes it in the
+// response header, if not set yet. The logger, if any, is prefixed by it.
+func (x *RouteContext) resolveRequestID(w http.ResponseWriter, r *http.Request, ids *RequestIDs) {
+	if ids == nil || x.RequestID != "" {
+		return
+	}
+	x.RequestID = ids.Resolve(r)
+	w.Header().Set(ids.header(), x.RequestID)
+	if x.Log != nil {
+		x.Log = logging.WithPrefix(x.Log, x.RequestID)
+	}
+}
+
+// AbsoluteURL returns the absolute URL of `path`, with the scheme and host of
+// the request.
+func (x *RouteContext) AbsoluteURL(path string) string {
+	if x.Host == "" {
+		return path
+	}
+	scheme := x.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + x.Host + path
+}
+
+// URLFor returns the absolute URL of the route `pattern` with the `params`
+// (see BuildPath).
+func (x *RouteContext) URLFor(pattern string, params map[string]string) (string, error) {
+	path, err := BuildPath(pattern, params)
+	if err != nil {
+		return "", err
+	}
+	return x.AbsoluteURL(path), nil
 }
 
 // URLParam returns the corresponding URL parameter value from the request
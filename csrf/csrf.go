@@ -0,0 +1,327 @@
+// Package csrf implements the cross-site request forgery protection of
+// xroute, with the synchronizer token pattern, storing the token in the
+// session, or the double submit cookie pattern.
+//
+// The protection is a handler interseptor, so it runs after routing and
+// routes can opt out with metadata:
+//
+//	protector := csrf.New(csrf.SynchronizerToken)
+//	protector.TrustedOrigins = []string{"https://app.example.com"}
+//	r.Use(sessions.Middleware())
+//	r.HandlerIntersept(protector.Interseptor())
+//	r.With(xroute.Meta{csrf.MetaKey: false}).Post("/webhooks/github", githubHook)
+//
+// Templates get the token with Token:
+//
+//	<input type="hidden" name="csrf_token" value="{{ .CSRFToken }}">
+//
+// Requests with unsafe methods must send the token in the header or the form
+// field, and their Origin, or else Referer, must be the one of the request or
+// a trusted one. API routes (see xroute.Router.Api) constrained to non-form
+// content types are exempt: browsers can't send them cross-site without a
+// CORS preflight.
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/moisespsena-go/xroute"
+	"github.com/moisespsena-go/xroute/session"
+)
+
+// Name is the name of the CSRF handler interseptor.
+const Name = "csrf"
+
+// MetaKey is the route metadata key that disables the protection of the
+// routes, if false.
+const MetaKey = "csrf"
+
+// Mode is the token pattern.
+type Mode int
+
+const (
+	// SynchronizerToken stores the token in the session (see the session
+	// package).
+	SynchronizerToken Mode = iota
+	// DoubleSubmit stores the token in a cookie, that the requests send back
+	// in the header or form field.
+	DoubleSubmit
+)
+
+const (
+	tokenLen   = 32
+	sessionKey = "_csrf"
+)
+
+var (
+	ErrBadOrigin = errors.New("csrf: origin not allowed")
+	ErrBadToken  = errors.New("csrf: invalid token")
+	ErrNoSession = errors.New("csrf: session not available")
+
+	errTokenMissing = errors.New("csrf: token missing")
+)
+
+var (
+	safeMethods = []string{"GET", "HEAD", "OPTIONS", "TRACE"}
+
+	// formMediaTypes are the content types browsers send cross-site without
+	// a CORS preflight.
+	formMediaTypes = []string{"application/x-www-form-urlencoded", "multipart/form-data", "text/plain"}
+)
+
+// Protector is the CSRF protection.
+type Protector struct {
+	Mode Mode
+
+	// HeaderName and FieldName are the request header and form field of the
+	// token.
+	HeaderName string
+	FieldName  string
+
+	// The double submit cookie attributes.
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+
+	// TrustedOrigins are the origins allowed besides the one of the
+	// request, such as https://app.example.com.
+	TrustedOrigins []string
+}
+
+// New returns a new protector of the token pattern `mode`.
+func New(mode Mode) *Protector {
+	return &Protector{
+		Mode:       mode,
+		HeaderName: "X-CSRF-Token",
+		FieldName:  "csrf_token",
+		CookieName: "csrf_token",
+		Path:       "/",
+		SameSite:   http.SameSiteLaxMode,
+	}
+}
+
+type stateKey struct{}
+
+// state is the token state of a request.
+type state struct {
+	p      *Protector
+	w      http.ResponseWriter
+	r      *http.Request
+	rctx   *xroute.RouteContext
+	secret []byte
+}
+
+// Token returns the masked CSRF token of the request, for forms and
+// templates, or an empty string if the request isn't protected. The token is
+// created on the first use, and is different on each call, to prevent BREACH
+// attacks.
+func Token(rctx *xroute.RouteContext) string {
+	st, ok := rctx.Data[stateKey{}].(*state)
+	if !ok {
+		return ""
+	}
+	secret, err := st.getSecret(true)
+	if err != nil {
+		return ""
+	}
+	return mask(secret)
+}
+
+// FieldName returns the form field name of the token, or an empty string if
+// the request isn't protected.
+func FieldName(rctx *xroute.RouteContext) string {
+	if st, ok := rctx.Data[stateKey{}].(*state); ok {
+		return st.p.FieldName
+	}
+	return ""
+}
+
+// getSecret returns the token secret, creating it if `create`.
+func (st *state) getSecret(create bool) ([]byte, error) {
+	if st.secret != nil {
+		return st.secret, nil
+	}
+
+	var stored string
+	var s *session.Session
+	if st.p.Mode == SynchronizerToken {
+		var err error
+		if s, err = session.Get(st.rctx); err != nil {
+			return nil, ErrNoSession
+		}
+		stored, _ = s.Get(sessionKey).(string)
+	} else if cookie, err := st.r.Cookie(st.p.CookieName); err == nil {
+		stored = cookie.Value
+	}
+	if secret, err := base64.RawURLEncoding.DecodeString(stored); err == nil && len(secret) == tokenLen {
+		st.secret = secret
+		return secret, nil
+	}
+	if !create {
+		return nil, errTokenMissing
+	}
+
+	st.secret = make([]byte, tokenLen)
+	if _, err := rand.Read(st.secret); err != nil {
+		return nil, err
+	}
+	value := base64.RawURLEncoding.EncodeToString(st.secret)
+	if s != nil {
+		s.Set(sessionKey, value)
+	} else {
+		http.SetCookie(st.w, &http.Cookie{
+			Name:     st.p.CookieName,
+			Value:    value,
+			Path:     st.p.Path,
+			Domain:   st.p.Domain,
+			Secure:   st.p.Secure,
+			SameSite: st.p.SameSite,
+		})
+	}
+	return st.secret, nil
+}
+
+// Interseptor returns the named CSRF handler interseptor.
+func (p *Protector) Interseptor() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: p.Handler}
+}
+
+// Handler is the CSRF interseptor handler.
+func (p *Protector) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	if enabled, ok := rctx.Meta[MetaKey].(bool); ok && !enabled {
+		chain.Next()
+		return
+	}
+	st := &state{p: p, w: chain.Writer, r: r, rctx: rctx}
+	rctx.Data[stateKey{}] = st
+
+	if err := p.Check(r, rctx); err != nil {
+		xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusForbidden, err))
+		return
+	}
+	chain.Next()
+}
+
+// Check checks the origin and the token of the request. Requests with safe
+// methods and exempt API routes always pass.
+func (p *Protector) Check(r *http.Request, rctx *xroute.RouteContext) error {
+	for _, m := range safeMethods {
+		if r.Method == m {
+			return nil
+		}
+	}
+	if apiExempt(rctx) {
+		return nil
+	}
+	if !p.originAllowed(r, rctx) {
+		return ErrBadOrigin
+	}
+
+	st, ok := rctx.Data[stateKey{}].(*state)
+	if !ok {
+		st = &state{p: p, r: r, rctx: rctx}
+	}
+	secret, err := st.getSecret(false)
+	if err != nil {
+		if err == errTokenMissing {
+			return ErrBadToken
+		}
+		return err
+	}
+	token := r.Header.Get(p.HeaderName)
+	if token == "" {
+		token = r.PostFormValue(p.FieldName)
+	}
+	if sent := unmask(token); sent == nil || subtle.ConstantTimeCompare(sent, secret) != 1 {
+		return ErrBadToken
+	}
+	return nil
+}
+
+// originAllowed checks the Origin header, or else the Referer header, if any
+// of them is set. The host of the request is the one resolved by the router
+// (see xroute.TrustedProxies).
+func (p *Protector) originAllowed(r *http.Request, rctx *xroute.RouteContext) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return origin == ""
+		}
+		u, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	for _, trusted := range p.TrustedOrigins {
+		if strings.EqualFold(origin, trusted) {
+			return true
+		}
+	}
+	host := rctx.Host
+	if host == "" {
+		host = r.Host
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
+
+// apiExempt reports whether the route is an API route constrained to non-form
+// content types.
+func apiExempt(rctx *xroute.RouteContext) bool {
+	if api, _ := rctx.Meta[xroute.MetaAPI].(bool); !api {
+		return false
+	}
+	types := rctx.EndpointConstraints.Header[http.CanonicalHeaderKey("Content-Type")]
+	if len(types) == 0 {
+		return false
+	}
+	for _, t := range types {
+		mediaType, _, err := mime.ParseMediaType(t)
+		if err != nil {
+			return false
+		}
+		for _, form := range formMediaTypes {
+			if mediaType == form {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mask returns the secret masked with a random one time pad, encoded.
+func mask(secret []byte) string {
+	token := make([]byte, 2*len(secret))
+	pad := token[:len(secret)]
+	if _, err := rand.Read(pad); err != nil {
+		panic(err)
+	}
+	for i, b := range secret {
+		token[len(secret)+i] = b ^ pad[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func unmask(token string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 2*tokenLen {
+		return nil
+	}
+	secret := make([]byte, tokenLen)
+	for i := range secret {
+		secret[i] = data[i] ^ data[tokenLen+i]
+	}
+	return secret
+}
@@ -0,0 +1,106 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+	"github.com/moisespsena-go/xroute/session"
+)
+
+func newRouter(p *Protector) *xroute.Mux {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	r := xroute.NewRouter()
+	r.Use(session.New(session.NewMemoryStore()).Middleware())
+	r.HandlerIntersept(p.Interseptor())
+	r.Get("/form", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		w.Write([]byte(Token(rctx)))
+	})
+	r.Post("/form", ok)
+	r.With(xroute.Meta{MetaKey: false}).Post("/webhooks", ok)
+	r.Api(func(r xroute.Router) {
+		r.Headers(http.Header{"Content-Type": {"application/json"}}, func(r xroute.Router) {
+			r.Post("/api/items", ok)
+		})
+		r.Post("/api/forms", ok)
+	})
+	return r
+}
+
+type client struct {
+	h       http.Handler
+	cookies []*http.Cookie
+}
+
+func (c *client) do(req *http.Request) *httptest.ResponseRecorder {
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, req)
+	if cookies := w.Result().Cookies(); len(cookies) > 0 {
+		c.cookies = cookies
+	}
+	return w
+}
+
+func TestProtector(t *testing.T) {
+	for _, mode := range []Mode{SynchronizerToken, DoubleSubmit} {
+		p := New(mode)
+		p.TrustedOrigins = []string{"https://app.example.com"}
+		c := &client{h: newRouter(p)}
+
+		token := c.do(httptest.NewRequest("GET", "/form", nil)).Body.String()
+		if token == "" || len(c.cookies) != 1 {
+			t.Fatalf("mode %d: expecting token and cookie, got %q %v", mode, token, c.cookies)
+		}
+		if other := c.do(httptest.NewRequest("GET", "/form", nil)).Body.String(); other == token {
+			t.Fatalf("mode %d: expecting masked tokens to differ", mode)
+		}
+
+		post := func(path, contentType, body string, header http.Header) int {
+			req := httptest.NewRequest("POST", path, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			for k, v := range header {
+				req.Header[k] = v
+			}
+			return c.do(req).Code
+		}
+		form := "application/x-www-form-urlencoded"
+
+		tests := []struct {
+			path, contentType, body string
+			header                  http.Header
+			status                  int
+		}{
+			{"/form", form, url.Values{"csrf_token": {token}}.Encode(), nil, 200},
+			{"/form", form, "", http.Header{"X-Csrf-Token": {token}}, 200},
+			{"/form", form, "", http.Header{"X-Csrf-Token": {token}, "Origin": {"https://app.example.com"}}, 200},
+			{"/form", form, "", http.Header{"X-Csrf-Token": {token}, "Origin": {"http://example.com"}}, 200},
+			{"/form", form, "", http.Header{"X-Csrf-Token": {token}, "Origin": {"https://evil.com"}}, 403},
+			{"/form", form, "", http.Header{"X-Csrf-Token": {token}, "Referer": {"https://evil.com/page"}}, 403},
+			{"/form", form, "", nil, 403},
+			{"/form", form, "", http.Header{"X-Csrf-Token": {"bad"}}, 403},
+			{"/webhooks", form, "", http.Header{"Origin": {"https://evil.com"}}, 200},
+			{"/api/items", "application/json", "{}", nil, 200},
+			{"/api/forms", form, "", nil, 403},
+		}
+		for i, tt := range tests {
+			if status := post(tt.path, tt.contentType, tt.body, tt.header); status != tt.status {
+				t.Fatalf("mode %d: input [%d]: %s expecting %d, got %d", mode, i, tt.path, tt.status, status)
+			}
+		}
+
+		// tokens of other clients are rejected
+		other := &client{h: c.h}
+		otherToken := other.do(httptest.NewRequest("GET", "/form", nil)).Body.String()
+		if status := post("/form", form, "", http.Header{"X-Csrf-Token": {otherToken}}); status != 403 {
+			t.Fatalf("mode %d: expecting other client token rejected, got %d", mode, status)
+		}
+	}
+}
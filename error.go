@@ -2,6 +2,9 @@ package xroute
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/go-errors/errors"
 )
@@ -19,3 +22,68 @@ type BadPathern struct {
 func (this BadPathern) Error() string {
 	return fmt.Sprintf("bad route pattern %q: %s", this.pattern, this.message)
 }
+
+// HTTPError is an error replied with an HTTP status code.
+type HTTPError struct {
+	Status int
+	Err    error
+}
+
+// NewHTTPError returns a new HTTP error. If `err` is nil, the message is the
+// status text.
+func NewHTTPError(status int, err error) *HTTPError {
+	return &HTTPError{status, err}
+}
+
+func (this *HTTPError) Error() string {
+	if this.Err != nil {
+		return this.Err.Error()
+	}
+	return http.StatusText(this.Status)
+}
+
+func (this *HTTPError) Unwrap() error {
+	return this.Err
+}
+
+// ErrorStatus returns the HTTP status code of `err`: the status of an
+// *HTTPError, or 500.
+func ErrorStatus(err interface{}) int {
+	if herr, ok := err.(*HTTPError); ok {
+		return herr.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// DefaultErrorHandler replies the error status text. In debug mode, the
+// error message is added.
+func DefaultErrorHandler(URL *url.URL, debug bool, w ResponseWriter, r *http.Request, context *RouteContext, begin time.Time, err interface{}) {
+	status := ErrorStatus(err)
+	msg := http.StatusText(status)
+	if debug {
+		msg += ": " + fmt.Sprint(err)
+	}
+	http.Error(w, msg, status)
+}
+
+// ServeError replies `err` with the error handler of the nearest router of
+// `rctx` that has one (see Mux.SetErrorHandler), or with DefaultErrorHandler.
+func ServeError(w http.ResponseWriter, r *http.Request, rctx *RouteContext, err error) {
+	handler, debug := ErrorHandler(DefaultErrorHandler), false
+	if rctx != nil {
+		for i := len(rctx.RouterStack) - 1; i >= 0; i-- {
+			if mx, ok := rctx.RouterStack[i].(*Mux); ok {
+				debug = debug || mx.debug
+				if mx.errorHandler != nil {
+					handler = mx.errorHandler
+					break
+				}
+			}
+		}
+	}
+	ws, ok := w.(ResponseWriter)
+	if !ok {
+		ws = NewResponseWriter(w)
+	}
+	handler(r.URL, debug, ws, r, rctx, time.Now(), err)
+}
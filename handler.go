@@ -166,14 +166,41 @@ func (eh EndpointHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (eh EndpointHandler) ServeHTTPContext(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
-	if h := eh.find(r.Header); h == nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if h := eh.find(r, rctx); h == nil {
+		serveConstraintMismatch(w, r, rctx)
 	} else {
-		rctx.Handler = h
-		h.handler.ServeHTTPContext(w, r, rctx)
+		rctx.setEndpoint(h)
+		serveEndpoint(h.handler, w, r, rctx)
 	}
 }
 
+// setEndpoint records the selected endpoint handler in the route context.
+func (x *RouteContext) setEndpoint(v *endpointVariant) {
+	x.Handler = v.handler
+	x.EndpointHeaders = v.constraints.Header
+	x.EndpointConstraints = v.constraints
+	x.Meta = x.Meta.Merge(v.meta)
+}
+
+// EndpointVariant is an endpoint handler, its constraints and metadata.
+type EndpointVariant struct {
+	// Headers are the header constraints, the same as Constraints.Header.
+	Headers     http.Header
+	Constraints Constraints
+	Meta        Meta
+	Handler     ContextHandler
+}
+
+// Variants returns the endpoint handlers, their constraints and metadata, in
+// registration order.
+func (eh EndpointHandler) Variants() []EndpointVariant {
+	variants := make([]EndpointVariant, len(eh.handlers))
+	for i, v := range eh.handlers {
+		variants[i] = EndpointVariant{v.constraints.Header, v.constraints, v.meta, v.handler}
+	}
+	return variants
+}
+
 type FallbackHandlers []ContextHandler
 
 func (this FallbackHandlers) ServeHTTPContext(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
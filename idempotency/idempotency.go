@@ -0,0 +1,253 @@
+// Package idempotency implements the `Idempotency-Key` header for unsafe
+// methods, so clients can retry requests without repeating their effects.
+//
+// The first response of a key is stored, and replayed on retries. Retries of
+// a request being handled, or whose response was too large to be stored, are
+// replied 409, and reuses of a key with another payload are replied 422.
+// Keys are scoped by the route pattern and the principal, so it must run
+// after routing and authentication:
+//
+//	idem := idempotency.New(idempotency.NewMemoryStore())
+//	r.With(idem.Middleware()).Post("/payments", createPayment)
+package idempotency
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+const (
+	// Name is the name of the idempotency middleware.
+	Name = "idempotency"
+
+	// HeaderName is the request header of the keys.
+	HeaderName = "Idempotency-Key"
+
+	// ReplayedHeader is set in the replayed responses.
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	// DefaultTTL is the default retention of the stored responses.
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultLockTimeout is the default retention of the keys of the
+	// requests being handled.
+	DefaultLockTimeout = time.Minute
+
+	// DefaultMaxBodySize is the default size limit of the request and
+	// response bodies.
+	DefaultMaxBodySize = 1 << 20
+
+	maxKeySize = 255
+)
+
+var (
+	ErrInFlight    = errors.New("idempotency: request with the same key in progress")
+	ErrMismatch    = errors.New("idempotency: key reused with another payload")
+	ErrBadKey      = errors.New("idempotency: bad key")
+	ErrKeyRequired = errors.New("idempotency: key required")
+	ErrTooLarge    = errors.New("idempotency: request body too large")
+	ErrDiscarded   = errors.New("idempotency: request with the same key handled, response not stored")
+	ErrNotOwner    = errors.New("idempotency: key not reserved by the request")
+)
+
+// Idempotency is the idempotency middleware.
+type Idempotency struct {
+	Store Store
+
+	// Methods are the handled methods. Defaults to POST and PATCH.
+	Methods []string
+
+	// Required replies 400 to the requests without key.
+	Required bool
+
+	// TTL is the retention of the stored responses. Defaults to DefaultTTL.
+	TTL time.Duration
+
+	// LockTimeout is the retention of the keys of the requests being
+	// handled, if they are never completed. Defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+
+	// MaxBodySize is the size limit of the request and response bodies.
+	// Larger requests are replied 413. Larger responses aren't stored, and
+	// the retries of their requests are replied 409. Defaults to
+	// DefaultMaxBodySize.
+	MaxBodySize int
+}
+
+// New returns a new idempotency middleware of the store.
+func New(store Store) *Idempotency {
+	return &Idempotency{Store: store}
+}
+
+// Middleware returns the named idempotency middleware. It must run after
+// routing: attach it with With, Group or HandlerIntersept.
+func (i *Idempotency) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: i.Handler}
+}
+
+// Handler is the idempotency middleware handler.
+func (i *Idempotency) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	if !i.handles(r.Method) {
+		chain.Next()
+		return
+	}
+	key := r.Header.Get(HeaderName)
+	switch {
+	case key == "" && i.Required:
+		xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusBadRequest, ErrKeyRequired))
+		return
+	case key == "":
+		chain.Next()
+		return
+	case len(key) > maxKeySize:
+		xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusBadRequest, ErrBadKey))
+		return
+	}
+
+	limit := i.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(io.LimitReader(r.Body, int64(limit)+1)); err != nil {
+			xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusBadRequest, err))
+			return
+		}
+		if len(body) > limit {
+			xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusRequestEntityTooLarge, ErrTooLarge))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	var principal string
+	if p := rctx.Principal(); p != nil {
+		principal = p.ID
+	}
+	key = principal + "\x00" + rctx.RoutePattern() + "\x00" + key
+	fingerprint := Fingerprint(r, body)
+
+	lockTimeout := i.LockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = DefaultLockTimeout
+	}
+	owner := newOwner()
+	res, err := i.Store.Begin(key, fingerprint, owner, lockTimeout)
+	switch {
+	case err != nil:
+		xroute.ServeError(chain.Writer, r, rctx, err)
+		return
+	case res != nil && res.Fingerprint != fingerprint:
+		xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusUnprocessableEntity, ErrMismatch))
+		return
+	case res != nil && res.InFlight:
+		xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusConflict, ErrInFlight))
+		return
+	case res != nil && res.Discarded:
+		xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusConflict, ErrDiscarded))
+		return
+	case res != nil:
+		replay(chain.Writer, res)
+		return
+	}
+
+	bw := xroute.NewBufferedWriter(chain.Writer, limit)
+	stored := false
+	defer func() {
+		if !stored {
+			if err := i.Store.Abort(key, owner); err != nil && rctx.Log != nil {
+				rctx.Log.Errorf("idempotency: abort failed: %v", err)
+			}
+		}
+		bw.Commit()
+	}()
+
+	chain.Next(xroute.ResponseWriter(bw))
+
+	// server errors aren't stored, so the request can be retried
+	status := bw.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= 500 {
+		return
+	}
+
+	ttl := i.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	res = &Response{Fingerprint: fingerprint, Status: status}
+	if bw.Buffered() {
+		res.Header = bw.Header().Clone()
+		res.Body = append([]byte{}, bw.Body()...)
+	} else {
+		// the request must not be handled again, even if the response can't
+		// be replayed
+		res.Discarded = true
+	}
+	if err := i.Store.Complete(key, owner, res, ttl); err != nil {
+		if rctx.Log != nil {
+			rctx.Log.Errorf("idempotency: store failed: %v", err)
+		}
+		return
+	}
+	stored = true
+}
+
+func (i *Idempotency) handles(method string) bool {
+	methods := i.Methods
+	if methods == nil {
+		methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// newOwner returns a new random owner token of the keys.
+func newOwner() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Fingerprint returns the payload fingerprint of the request: the hash of
+// the method, the URL and the body.
+func Fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay writes the stored response. The headers already set for the
+// current request, such as the request ID, are kept.
+func replay(w http.ResponseWriter, res *Response) {
+	header := w.Header()
+	for k, v := range res.Header {
+		if _, ok := header[k]; !ok {
+			header[k] = append([]string{}, v...)
+		}
+	}
+	header.Set(ReplayedHeader, "true")
+	w.WriteHeader(res.Status)
+	w.Write(res.Body)
+}
@@ -0,0 +1,159 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func TestIdempotency(t *testing.T) {
+	var (
+		calls   int
+		release = make(chan bool)
+		entered = make(chan bool)
+	)
+	idem := New(NewMemoryStore())
+	r := xroute.NewRouter()
+	r.Use(func(chain *xroute.ChainHandler) {
+		if user := chain.Request().Header.Get("X-User"); user != "" {
+			chain.Context.SetPrincipal(&xroute.Principal{ID: user})
+		}
+		chain.Next()
+	})
+	r.With(idem.Middleware()).Post("/payments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			entered <- true
+			<-release
+		}
+		if r.URL.Query().Get("fail") != "" {
+			http.Error(w, "down", 503)
+			return
+		}
+		calls++
+		w.Header().Set("Location", "/payments/"+strconv.Itoa(calls))
+		w.WriteHeader(201)
+		w.Write([]byte(strconv.Itoa(calls)))
+	})
+
+	do := func(path, key, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(HeaderName, key)
+		}
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		path, key, user, body string
+		status                int
+		response              string
+		replayed              bool
+	}{
+		{"/payments", "k1", "ann", "10", 201, "1", false},
+		{"/payments", "k1", "ann", "10", 201, "1", true},
+		{"/payments", "k1", "ann", "20", 422, "", false},
+		{"/payments", "k1", "bob", "10", 201, "2", false},
+		{"/payments", "", "ann", "10", 201, "3", false},
+		{"/payments?fail=1", "k2", "ann", "10", 503, "", false},
+		{"/payments?fail=1", "k2", "ann", "10", 503, "", false},
+	}
+	for i, tt := range tests {
+		w := do(tt.path, tt.key, tt.user, tt.body)
+		if w.Code != tt.status || tt.response != "" && w.Body.String() != tt.response || (w.Header().Get(ReplayedHeader) != "") != tt.replayed {
+			t.Fatalf("input [%d]: expecting %d %q replayed %v, got %d %q %v", i, tt.status, tt.response, tt.replayed, w.Code, w.Body.String(), w.Header())
+		}
+		if tt.replayed && w.Header().Get("Location") != "/payments/1" {
+			t.Fatalf("input [%d]: expecting replayed header, got %v", i, w.Header())
+		}
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- do("/payments?slow=1", "k3", "ann", "10") }()
+	<-entered
+	if w := do("/payments?slow=1", "k3", "ann", "10"); w.Code != 409 {
+		t.Fatalf("expecting in-flight conflict, got %d", w.Code)
+	}
+	release <- true
+	if w := <-done; w.Code != 201 {
+		t.Fatalf("expecting first request done, got %d", w.Code)
+	}
+}
+
+func TestIdempotencyDiscarded(t *testing.T) {
+	calls := 0
+	idem := New(NewMemoryStore())
+	idem.MaxBodySize = 4
+	r := xroute.NewRouter()
+	r.With(idem.Middleware()).Post("/exports", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(201)
+		w.Write([]byte("export " + strconv.Itoa(calls)))
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/exports", nil)
+		req.Header.Set(HeaderName, "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := do(); w.Code != 201 || w.Body.String() != "export 1" {
+		t.Fatalf("expecting full response, got %d %q", w.Code, w.Body.String())
+	}
+	if w := do(); w.Code != 409 || calls != 1 {
+		t.Fatalf("expecting conflict without handling the request again, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	if res, _ := s.Begin("k", "f", "o1", time.Minute); res != nil {
+		t.Fatalf("expecting new key, got %+v", res)
+	}
+	if res, _ := s.Begin("k", "f", "o2", time.Minute); res == nil || !res.InFlight {
+		t.Fatalf("expecting in-flight key, got %+v", res)
+	}
+	if err := s.Complete("k", "o2", &Response{Fingerprint: "f", Status: 200}, time.Hour); err != ErrNotOwner {
+		t.Fatalf("expecting ErrNotOwner, got %v", err)
+	}
+	s.Abort("k", "o2")
+	if res, _ := s.Begin("k", "f", "o2", time.Minute); res == nil || !res.InFlight {
+		t.Fatalf("expecting key kept by other owners, got %+v", res)
+	}
+	if err := s.Complete("k", "o1", &Response{Fingerprint: "f", Status: 201}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := s.Begin("k", "f", "o2", time.Minute); res == nil || res.Status != 201 {
+		t.Fatalf("expecting stored response, got %+v", res)
+	}
+	now = now.Add(2 * time.Hour)
+	if res, _ := s.Begin("k", "f", "o3", time.Minute); res != nil || s.Len() != 1 {
+		t.Fatalf("expecting expired key, got %+v", res)
+	}
+	s.Abort("k", "o1")
+	if s.Len() != 1 {
+		t.Fatalf("expecting key kept by other owners")
+	}
+	s.Abort("k", "o3")
+	if s.Len() != 0 {
+		t.Fatalf("expecting aborted key removed")
+	}
+
+	// expired reservations can't be completed
+	s.Begin("k", "f", "o4", time.Minute)
+	now = now.Add(2 * time.Minute)
+	if err := s.Complete("k", "o4", &Response{Fingerprint: "f", Status: 201}, time.Hour); err != ErrNotOwner {
+		t.Fatalf("expecting ErrNotOwner, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package idempotency
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Response is the stored response of a key.
+type Response struct {
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+
+	// InFlight reports whether the request of the key is being handled, so
+	// there is no response yet.
+	InFlight bool
+
+	// Discarded reports whether the response was too large to be stored:
+	// the request was handled, but its response can't be replayed.
+	Discarded bool
+}
+
+// Store stores the responses of the keys.
+type Store interface {
+	// Begin reserves the key for the request of the `fingerprint` and the
+	// `owner` token, up to `timeout`. If the key is already reserved or
+	// completed, it returns its response instead.
+	Begin(key, fingerprint, owner string, timeout time.Duration) (*Response, error)
+
+	// Complete stores the response of the key reserved by `owner`, up to
+	// `ttl`. It fails with ErrNotOwner if the key isn't reserved by `owner`,
+	// such as after the reservation timeout.
+	Complete(key, owner string, res *Response, ttl time.Duration) error
+
+	// Abort releases the key reserved by `owner`, so the request can be
+	// retried. Keys not reserved by `owner` are kept.
+	Abort(key, owner string) error
+}
+
+type memoryEntry struct {
+	res     *Response
+	owner   string
+	expires time.Time
+}
+
+// MemoryStore is an in-memory store. Expired keys are swept by Begin, at
+// most once per minute.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns a new in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, now: time.Now}
+}
+
+func (s *MemoryStore) Begin(key, fingerprint, owner string, timeout time.Duration) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !now.Before(s.nextSweep) {
+		for k, e := range s.entries {
+			if !now.Before(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.nextSweep = now.Add(time.Minute)
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.res, nil
+	}
+	s.entries[key] = &memoryEntry{&Response{Fingerprint: fingerprint, InFlight: true}, owner, now.Add(timeout)}
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(key, owner string, res *Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.owns(key, owner) {
+		return ErrNotOwner
+	}
+	s.entries[key] = &memoryEntry{res: res, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Abort(key, owner string) error {
+	s.mu.Lock()
+	if s.owns(key, owner) {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// owns reports whether the key is reserved by `owner`, and not expired.
+func (s *MemoryStore) owns(key, owner string) bool {
+	e, ok := s.entries[key]
+	return ok && e.res.InFlight && e.owner == owner && s.now().Before(e.expires)
+}
+
+// Len returns the number of stored keys, including the expired ones.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
@@ -0,0 +1,49 @@
+// Package traceparent parses the W3C `traceparent` header, for the request
+// IDs of xroute and the tracing package.
+package traceparent
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// Parse parses a `traceparent` header value. Future versions are accepted as
+// long as they start with the version 00 fields. The trace and span ids of
+// valid values aren't zero.
+func Parse(value string) (traceID [16]byte, spanID [8]byte, flags byte, ok bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return
+	}
+
+	var version [1]byte
+	if _, err := hex.Decode(version[:], []byte(value[0:2])); err != nil || version[0] == 0xff ||
+		strings.ToLower(value[0:2]) != value[0:2] {
+		return
+	}
+	if version[0] == 0 && len(value) != 55 {
+		return
+	} else if len(value) > 55 && value[55] != '-' {
+		return
+	}
+
+	if !decodeLowerHex(traceID[:], value[3:35]) ||
+		!decodeLowerHex(spanID[:], value[36:52]) {
+		return
+	}
+	var f [1]byte
+	if !decodeLowerHex(f[:], value[53:55]) {
+		return
+	}
+	flags = f[0]
+	ok = traceID != [16]byte{} && spanID != [8]byte{}
+	return
+}
+
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -17,5 +17,13 @@ func NewLogger(host string) logging.Logger {
 }
 
 func DefaultRequestLoggerFactory(r *http.Request, ctx *RouteContext) logging.Logger {
-	return logging.WithPrefix(NewLogger(r.Host), r.RemoteAddr)
+	host, addr := r.Host, r.RemoteAddr
+	if ctx != nil && ctx.ClientIP != "" {
+		host, addr = ctx.Host, ctx.ClientIP
+	}
+	log := logging.WithPrefix(NewLogger(host), addr)
+	if ctx != nil && ctx.RequestID != "" {
+		log = logging.WithPrefix(log, ctx.RequestID)
+	}
+	return log
 }
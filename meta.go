@@ -0,0 +1,50 @@
+package xroute
+
+import "fmt"
+
+// Meta is the metadata of routes, such as permission names, rate limit
+// classes or documentation. It's set by passing it to Use or With:
+//
+//	r.With(xroute.Meta{"perm": "users.read"}).Get("/users/{id}", showUser)
+//
+// The metadata of a router applies to all of its routes, the metadata of
+// inline routers (With and Group) to the routes registered through them.
+// Mounted routers inherit the metadata of the mount point. At request time,
+// the metadata of the matched endpoint, merged down from the routers, is in
+// RouteContext.Meta.
+type Meta map[string]interface{}
+
+// MetaAPI is the metadata key of the routes registered by Router.Api.
+const MetaAPI = "api"
+
+// Merge returns the metadata with the `o` metadata added. Keys of `o` replace
+// the keys of `m`. Neither of them is changed, and the result is always a new
+// map, so it can be changed without changing them.
+func (m Meta) Merge(o Meta) Meta {
+	merged := make(Meta, len(m)+len(o))
+	for k, v := range m {
+		merged[k] = v
+	}
+	for k, v := range o {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Get returns the value of `key`, or nil.
+func (m Meta) Get(key string) interface{} {
+	return m[key]
+}
+
+// String returns the value of `key` formatted as a string, or an empty string
+// if it isn't set.
+func (m Meta) String(key string) string {
+	v, ok := m[key]
+	if !ok {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,103 @@
+// Package metrics records request metrics labelled by the route pattern
+// instead of the raw path, and exposes them in the Prometheus text format.
+//
+//	m := metrics.New(nil)
+//	r.Use(m.Middleware())
+//	r.Mount("/metrics", m.Registry)
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the metrics middleware.
+const Name = "metrics"
+
+// Unmatched is the route label of requests without route pattern.
+const Unmatched = "unmatched"
+
+// OtherMethod is the method label of requests of nonstandard methods, so
+// clients can't create unlimited series by sending made-up methods.
+const OtherMethod = "OTHER"
+
+// Metrics are the HTTP request metrics.
+type Metrics struct {
+	Registry *Registry
+
+	// Requests counts the requests by method, route and status.
+	Requests *Counter
+	// Duration observes the request latencies, in seconds, by method, route
+	// and status.
+	Duration *Histogram
+	// ResponseSize observes the response body sizes, in bytes, by method,
+	// route and status.
+	ResponseSize *Histogram
+	// InFlight is the number of requests being served, by method.
+	InFlight *Gauge
+
+	now func() time.Time
+}
+
+// New registers the HTTP request metrics into `registry`. If `registry` is
+// nil, a new one is created.
+func New(registry *Registry) *Metrics {
+	if registry == nil {
+		registry = NewRegistry()
+	}
+	return &Metrics{
+		Registry: registry,
+		Requests: registry.NewCounter("http_requests_total",
+			"Total number of HTTP requests.", "method", "route", "status"),
+		Duration: registry.NewHistogram("http_request_duration_seconds",
+			"HTTP request latencies in seconds.", DefaultBuckets, "method", "route", "status"),
+		ResponseSize: registry.NewHistogram("http_response_size_bytes",
+			"HTTP response body sizes in bytes.", SizeBuckets, "method", "route", "status"),
+		InFlight: registry.NewGauge("http_requests_in_flight",
+			"Number of HTTP requests being served.", "method"),
+		now: time.Now,
+	}
+}
+
+// Middleware returns the named metrics middleware.
+func (m *Metrics) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: m.Handler}
+}
+
+// Handler is the metrics middleware handler. The route pattern is read
+// after the next handlers, so the middleware can be used before routing.
+func (m *Metrics) Handler(chain *xroute.ChainHandler) {
+	method := methodLabel(chain.Request().Method)
+	start := m.now()
+
+	m.InFlight.Inc(method)
+	defer m.InFlight.Dec(method)
+
+	chain.Next()
+
+	route := chain.Context.RoutePattern()
+	if route == "" {
+		route = Unmatched
+	}
+	status := chain.Writer.Status()
+	if status == 0 {
+		status = 200
+	}
+	code := strconv.Itoa(status)
+
+	m.Requests.Inc(method, route, code)
+	m.Duration.Observe(m.now().Sub(start).Seconds(), method, route, code)
+	m.ResponseSize.Observe(float64(chain.Writer.BytesWritten()), method, route, code)
+}
+
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return OtherMethod
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("jobs_total", "Jobs.\nDone.", "queue")
+	g := reg.NewGauge("temperature", "")
+	h := reg.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.5}, "op")
+
+	c.Inc(`a"b\`)
+	c.Add(2, "x")
+	g.Set(1.5)
+	g.Dec()
+	h.Observe(0.3, "get")
+	h.Observe(0.7, "get")
+	h.Observe(3, "get")
+
+	var b strings.Builder
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP jobs_total Jobs.\nDone.
+# TYPE jobs_total counter
+jobs_total{queue="a\"b\\"} 1
+jobs_total{queue="x"} 2
+# TYPE temperature gauge
+temperature 0.5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="get",le="0.5"} 1
+latency_seconds_bucket{op="get",le="1"} 2
+latency_seconds_bucket{op="get",le="+Inf"} 3
+latency_seconds_sum{op="get"} 4
+latency_seconds_count{op="get"} 3
+`
+	if b.String() != expected {
+		t.Fatalf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New(nil)
+	now := time.Unix(0, 0)
+	m.now = func() time.Time {
+		now = now.Add(20 * time.Millisecond)
+		return now
+	}
+
+	r := xroute.NewRouter()
+	r.Use(m.Middleware())
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user"))
+	})
+	r.Route("/api", func(r xroute.Router) {
+		r.Post("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+	})
+	r.Mount("/metrics", m.Registry)
+	r.NotFound(http.HandlerFunc(http.NotFound))
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, path := range []string{"/users/1", "/users/2", "/missing"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := http.Post(ts.URL+"/api/items/5", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for _, method := range []string{"BREW", "FOO"} {
+		req, _ := http.NewRequest(method, ts.URL+"/missing", nil)
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err = http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != ContentType {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		`http_requests_total{method="GET",route="/users/{id}",status="200"} 2`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_requests_total{method="POST",route="/api/items/{id}",status="201"} 1`,
+		`http_request_duration_seconds_bucket{method="GET",route="/users/{id}",status="200",le="0.025"} 2`,
+		`http_response_size_bytes_sum{method="GET",route="/users/{id}",status="200"} 8`,
+		`http_requests_in_flight{method="GET"} 1`,
+		`http_requests_in_flight{method="POST"} 0`,
+		`http_requests_in_flight{method="OTHER"} 0`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("missing %q in:\n%s", line, body)
+		}
+	}
+	if strings.Contains(string(body), "BREW") || strings.Contains(string(body), "FOO") {
+		t.Fatalf("unexpected nonstandard method label in:\n%s", body)
+	}
+}
@@ -0,0 +1,289 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are the default response size histogram buckets, in bytes.
+var SizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+// family is a metric with all of its label combinations.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.typ == histogramType {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing metric.
+type Counter struct{ f *family }
+
+// Inc increments the counter of the label values by one.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds `v` to the counter of the label values. Panics if `v` is negative.
+func (c *Counter) Add(v float64, labels ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.f.mu.Lock()
+	c.f.get(labels).value += v
+	c.f.mu.Unlock()
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct{ f *family }
+
+// Set sets the gauge of the label values to `v`.
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.f.mu.Lock()
+	g.f.get(labels).value = v
+	g.f.mu.Unlock()
+}
+
+// Add adds `v` to the gauge of the label values.
+func (g *Gauge) Add(v float64, labels ...string) {
+	g.f.mu.Lock()
+	g.f.get(labels).value += v
+	g.f.mu.Unlock()
+}
+
+// Inc increments the gauge of the label values by one.
+func (g *Gauge) Inc(labels ...string) {
+	g.Add(1, labels...)
+}
+
+// Dec decrements the gauge of the label values by one.
+func (g *Gauge) Dec(labels ...string) {
+	g.Add(-1, labels...)
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct{ f *family }
+
+// Observe adds the observation `v` to the histogram of the label values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.f.mu.Lock()
+	s := h.f.get(labels)
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+	h.f.mu.Unlock()
+}
+
+// Registry holds the metrics and writes them in the Prometheus text
+// exposition format. It is an http.Handler and can be mounted:
+//
+//	r.Mount("/metrics", registry)
+type Registry struct {
+	mu       sync.RWMutex
+	families []*family
+	names    map[string]bool
+}
+
+// NewRegistry returns a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", f.name))
+	}
+	r.names[f.name] = true
+	f.series = map[string]*series{}
+	r.families = append(r.families, f)
+	return f
+}
+
+// NewCounter registers a new counter.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(&family{name: name, help: help, typ: counterType, labels: labels})}
+}
+
+// NewGauge registers a new gauge.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(&family{name: name, help: help, typ: gaugeType, labels: labels})}
+}
+
+// NewHistogram registers a new histogram. If `buckets` is nil, DefaultBuckets
+// are used.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(&family{name: name, help: help, typ: histogramType, labels: labels, buckets: buckets})}
+}
+
+// WriteTo writes all metrics in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := append([]*family(nil), r.families...)
+	r.mu.RUnlock()
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+func (f *family) write(w *countWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if f.help != "" {
+		w.printf("# HELP %s %s\n", f.name, escapeHelp(f.help))
+	}
+	w.printf("# TYPE %s %s\n", f.name, f.typ)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != histogramType {
+			w.sample(f.name, f.labels, s.labels, s.value)
+			continue
+		}
+		names := append(append([]string(nil), f.labels...), "le")
+		values := append(append([]string(nil), s.labels...), "")
+		for i, upper := range f.buckets {
+			values[len(values)-1] = formatFloat(upper)
+			w.sample(f.name+"_bucket", names, values, float64(s.buckets[i]))
+		}
+		values[len(values)-1] = "+Inf"
+		w.sample(f.name+"_bucket", names, values, float64(s.count))
+		w.sample(f.name+"_sum", f.labels, s.labels, s.value)
+		w.sample(f.name+"_count", f.labels, s.labels, float64(s.count))
+	}
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countWriter) sample(name string, names, values []string, v float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(names) > 0 {
+		b.WriteByte('{')
+		for i, n := range names {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(n)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(values[i]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	w.printf("%s %s\n", b.String(), formatFloat(v))
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -28,6 +28,11 @@ type Middleware struct {
 	Handler func(chain *ChainHandler)
 	Before  []string
 	After   []string
+
+	// OptionalBefore and OptionalAfter are like Before and After, but
+	// the middlewares not registered are ignored.
+	OptionalBefore []string
+	OptionalAfter  []string
 }
 
 func NewMiddleware(f interface{}) *Middleware {
@@ -196,6 +201,16 @@ func (stack *MiddlewaresStack) Build() *MiddlewaresStack {
 				notFound[md.Name] = append(notFound[md.Name], from)
 			}
 		}
+		for _, to := range md.OptionalBefore {
+			if stack.Has(to) {
+				graph.AddEdge(md.Name, to)
+			}
+		}
+		for _, from := range md.OptionalAfter {
+			if stack.Has(from) {
+				graph.AddEdge(from, md.Name)
+			}
+		}
 	}
 
 	if len(notFound) > 0 {
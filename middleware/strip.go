@@ -28,7 +28,9 @@ func StripSlashes(next http.Handler) http.Handler {
 }
 
 // RedirectSlashes is a middleware that will match request paths with a trailing
-// slash and redirect to the same path, less the trailing slash.
+// slash and redirect to the same path, less the trailing slash. The redirect
+// URL is relative, unless the request came from a trusted proxy: then it has
+// the forwarded scheme and host (see xroute.TrustedProxies).
 //
 // NOTE: RedirectSlashes middleware is *incompatible* with http.FileServer,
 // see https://github.com/go-chi/chi/issues/343
@@ -47,6 +49,9 @@ func RedirectSlashes(next http.Handler) http.Handler {
 			} else {
 				path = path[:len(path)-1]
 			}
+			if rctx != nil && rctx.Forwarded {
+				path = rctx.AbsoluteURL(path)
+			}
 			http.Redirect(w, r, path, 301)
 			return
 		}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/go-chi/chi"
+	"github.com/moisespsena-go/xroute"
 )
 
 func TestStripSlashes(t *testing.T) {
@@ -168,3 +169,32 @@ func TestRedirectSlashes(t *testing.T) {
 
 	}
 }
+
+func TestRedirectSlashesTrustedProxies(t *testing.T) {
+	r := xroute.NewRouter()
+	r.TrustedProxies = xroute.MustTrustedProxies("10.0.0.0/8")
+	r.Use(RedirectSlashes)
+	r.Get("/accounts", func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		remote   string
+		header   http.Header
+		location string
+	}{
+		{"203.0.113.9:1234", nil, "/accounts"},
+		{"203.0.113.9:1234", http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"example.com"}}, "/accounts"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"example.com"}}, "https://example.com/accounts"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "http://evil.example/accounts/", nil)
+		req.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != 301 || w.Header().Get("Location") != tt.location {
+			t.Fatalf("input [%d]: expecting 301 %q, got %d %q", i, tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
@@ -75,6 +75,9 @@ type Mux struct {
 	// Custom route not found handler
 	notFoundHandler FallbackHandlers
 
+	// Custom handler of requests matching no endpoint constraints
+	constraintMismatchHandler ContextHandler
+
 	// Custom method not allowed handler
 	methodNotAllowedHandler ContextHandler
 	buildRouterMutex        sync.Mutex
@@ -82,9 +85,30 @@ type Mux struct {
 	interseptErrors         bool
 	debug                   bool
 	api                     bool
-	headers                 http.Header
+	constraints             Constraints
+	versioned               bool
+	meta                    Meta
 	ApiExtensions           []string
 
+	// Versioning reads the API version of the requests, if the router has
+	// versioned routes. Nil is DefaultVersioning.
+	Versioning *Versioning
+
+	// TrustedProxies resolves the client IP, scheme and host of the
+	// requests. Nil trusts no proxies.
+	TrustedProxies *TrustedProxies
+
+	// RequestIDs sets the request IDs of the requests. Nil doesn't set them.
+	RequestIDs *RequestIDs
+
+	// Rules are the redirect and rewrite rules applied before routing. Nil
+	// applies none.
+	Rules *Rules
+
+	// MultipartFormMethods are the methods of the accepted multipart form
+	// bodies. Nil is POST and PUT.
+	MultipartFormMethods []string
+
 	overrides bool
 }
 
@@ -187,6 +211,16 @@ func (mx *Mux) GetRouteHandler() ContextHandlerFunc {
 	return mx.routeHandler
 }
 
+// SetErrorHandler sets the handler of the errors replied with ServeError by
+// the router and its sub routers.
+func (mx *Mux) SetErrorHandler(handler ErrorHandler) {
+	mx.errorHandler = handler
+}
+
+func (mx *Mux) GetErrorHandler() ErrorHandler {
+	return mx.errorHandler
+}
+
 func (mx *Mux) IsArgSet() bool {
 	return mx.argSet
 }
@@ -205,8 +239,13 @@ func (mx *Mux) ClearArg() {
 	mx.argSet = false
 }
 
+// AcceptMultipartForm reports whether the router accepts multipart form
+// bodies for the `method` (see MultipartFormMethods).
 func (mx *Mux) AcceptMultipartForm(method string) bool {
-	return method == "POST" || method == "PUT"
+	if mx.MultipartFormMethods == nil {
+		return method == "POST" || method == "PUT"
+	}
+	return containsString(mx.MultipartFormMethods, method)
 }
 
 // ServeHTTP is the single method of the http.Handler interface that makes
@@ -224,6 +263,9 @@ func (mx *Mux) ServeHTTPContext(w http.ResponseWriter, r *http.Request, rctx *Ro
 		r, rctx = GetOrNewRouteContextForRequest(r)
 	}
 
+	rctx.resolveClient(r, mx.TrustedProxies)
+	rctx.resolveRequestID(w, r, mx.RequestIDs)
+
 	if rctx.Log == nil {
 		rctx.Log = RequestLoggerFactory(r, rctx)
 	}
@@ -233,6 +275,8 @@ func (mx *Mux) ServeHTTPContext(w http.ResponseWriter, r *http.Request, rctx *Ro
 	ws := NewResponseWriter(w)
 	w = ws
 
+	defer rctx.begin(StepRouter, mx, w, r)()
+
 	// Ensure the mux has some routes defined on the mux
 	if mx.handler == nil {
 		// Build the final routing handler for this Mux.
@@ -295,7 +339,20 @@ func (mx *Mux) HandlerIntersept(interseptors ...interface{}) {
 // change the course of the request execution, or set request-scoped values for
 // the next Handler.
 func (mx *Mux) Use(middlewares ...interface{}) {
-	mx.middlewares.AddInterface(middlewares, DUPLICATION_ABORT)
+	var mws []interface{}
+	for _, md := range middlewares {
+		if meta, ok := md.(Meta); ok {
+			mx.meta = mx.meta.Merge(meta)
+		} else {
+			mws = append(mws, md)
+		}
+	}
+	mx.middlewares.AddInterface(mws, DUPLICATION_ABORT)
+}
+
+// Meta returns the metadata of the router, set by Use.
+func (mx *Mux) Meta() Meta {
+	return mx.meta
 }
 
 // Handle adds the route `pattern` that matches any http method to
@@ -425,6 +482,28 @@ func (mx *Mux) MethodNotAllowed(handler interface{}) {
 	})
 }
 
+// ConstraintMismatch sets a custom Handler for requests matching a route
+// whose handlers constraints don't match the request. The default handler
+// returns a 400 with an empty body.
+func (mx *Mux) ConstraintMismatch(handler interface{}) {
+	// Build ConstraintMismatch handler chain
+	m := mx
+	h := HttpHandler(handler)
+
+	if mx.inline && mx.parent != nil {
+		m = mx.parent
+		h = mx.chainHandler(h)
+	}
+
+	// Update the constraintMismatchHandler from this point forward
+	m.constraintMismatchHandler = h
+	m.updateSubRoutes(func(subMux *Mux) {
+		if subMux.constraintMismatchHandler == nil {
+			subMux.ConstraintMismatch(h)
+		}
+	})
+}
+
 // With adds inline middlewares for an endpoint handler.
 func (mx *Mux) With(middlewares ...interface{}) Router {
 	// Copy middlewares from parent inline muxs
@@ -444,6 +523,10 @@ func (mx *Mux) With(middlewares ...interface{}) Router {
 		middlewares:         md,
 		interseptors:        its,
 		handlerInterseptors: hits,
+		constraints:         mx.constraints,
+	}
+	if mx.inline {
+		im.meta = mx.meta
 	}
 	im.Use(middlewares...)
 	return im
@@ -503,6 +586,9 @@ func (mx *Mux) Mount(pattern string, handler interface{}) {
 	if ok && subr.methodNotAllowedHandler == nil && mx.methodNotAllowedHandler != nil {
 		subr.MethodNotAllowed(mx.methodNotAllowedHandler)
 	}
+	if ok && subr.constraintMismatchHandler == nil && mx.constraintMismatchHandler != nil {
+		subr.ConstraintMismatch(mx.constraintMismatchHandler)
+	}
 
 	httpHandler := HttpHandler(handler)
 	var mh ContextHandler
@@ -524,7 +610,7 @@ func (mx *Mux) Mount(pattern string, handler interface{}) {
 		// Wrap the Sub-router in a handlerFunc to scope the request path for routing.
 		mh = &MountHandler{func(w http.ResponseWriter, r *http.Request, ctx *RouteContext) {
 			ctx.RoutePath = mx.nextRoutePath(ctx)
-			httpHandler.ServeHTTPContext(w, r, ctx)
+			serveEndpoint(httpHandler, w, r, ctx)
 		}, handler}
 	}
 
@@ -561,7 +647,7 @@ func (mx *Mux) Routes() []Route {
 
 // Middlewares returns a slice of middleware handler functions.
 func (mx *Mux) Middlewares() Middlewares {
-	return mx.middlewares.Items
+	return mx.middlewares.Build().Items
 }
 
 // Match searches the routing tree for a handler that matches the method/path.
@@ -604,6 +690,15 @@ func (mx *Mux) MethodNotAllowedHandler() ContextHandler {
 	return methodNotAllowedHandler
 }
 
+// ConstraintMismatchHandler returns the default Mux 400 responder whenever
+// the request matches no constraints of the route handlers.
+func (mx *Mux) ConstraintMismatchHandler() ContextHandler {
+	if mx.constraintMismatchHandler != nil {
+		return mx.constraintMismatchHandler
+	}
+	return constraintMismatchHandler
+}
+
 // buildRouteHandler builds the single mux handler that is a chain of the middleware
 // stack, as defined by calls to Use(), and the tree router (Mux) itself. After this
 // point, no other middlewares can be registered on this Mux's stack. But you can still
@@ -612,12 +707,12 @@ func (mx *Mux) buildRouteHandler() {
 	mx.buildRouterMutex.Lock()
 	defer mx.buildRouterMutex.Unlock()
 	if mx.handler == nil {
-		h := HttpHandler(mx.routeHTTP)
+		var h ContextHandler = &routingHandler{HttpHandler(mx.routeHTTP)}
 		if mx.routeHandler != nil {
 			mainHandler := h
-			h = HttpHandler(func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+			h = &routingHandler{HttpHandler(func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
 				mx.routeHandler(mainHandler, w, r, rctx)
-			})
+			})}
 		}
 
 		var minterseptors []Middlewares
@@ -645,6 +740,9 @@ func (mx *Mux) chainHandler(h interface{}) Handler {
 	return Chain(append(append(Middlewares{}, mx.interseptors.Build().Items...), mx.middlewares.Build().Items...)...).Handler(h)
 }
 
+// Api registers the routes of `f` as API routes: they also match the paths
+// with the API extensions, such as /users.json, and have the MetaAPI
+// metadata set to true.
 func (mx *Mux) Api(f func(r Router)) {
 	old := mx.api
 	defer func() {
@@ -654,12 +752,47 @@ func (mx *Mux) Api(f func(r Router)) {
 	f(mx)
 }
 
+// Headers registers the routes of `f` with the header constraints.
 func (mx *Mux) Headers(headers http.Header, f func(r Router)) {
-	old := mx.headers
+	mx.Constrain(Constraints{Header: headers}, f)
+}
+
+// Query registers the routes of `f` with the query param constraints.
+func (mx *Mux) Query(values url.Values, f func(r Router)) {
+	mx.Constrain(Constraints{Query: values}, f)
+}
+
+// Cookies registers the routes of `f` with the cookie constraints.
+func (mx *Mux) Cookies(values url.Values, f func(r Router)) {
+	mx.Constrain(Constraints{Cookie: values}, f)
+}
+
+// When registers the routes of `f` with the predicate `name`.
+func (mx *Mux) When(name string, match func(r *http.Request, rctx *RouteContext) bool, f func(r Router)) {
+	mx.Constrain(Constraints{Predicates: []*Predicate{{name, match}}}, f)
+}
+
+// Version registers the routes of `f` for the API `version`. A request of a
+// version is served by the route of the same version or, if missing, of the
+// nearest lower version. Requests without a version are served by the latest
+// version, unless the Versioning has a default version. See Versioning.
+func (mx *Mux) Version(version string, f func(r Router)) {
+	m := mx
+	for m.inline && m.parent != nil {
+		m = m.parent
+	}
+	m.versioned = true
+	mx.Constrain(Constraints{Version: version}, f)
+}
+
+// Constrain registers the routes of `f` with the constraints, added to the
+// constraints of the enclosing calls.
+func (mx *Mux) Constrain(constraints Constraints, f func(r Router)) {
+	old := mx.constraints
 	defer func() {
-		mx.headers = old
+		mx.constraints = old
 	}()
-	mx.headers = headers
+	mx.constraints = old.Merge(constraints)
 	f(mx)
 }
 
@@ -692,24 +825,31 @@ func (mx *Mux) handle(method MethodType, pattern string, handler interface{}) (n
 	// Build endpoint handler with inline middlewares for the route
 	h := HttpHandler(handler)
 
+	// The metadata of inline routers is stored on the endpoint, the one of
+	// routers is merged at request time
+	var meta Meta
 	if mx.inline {
 		mx.handler = HttpHandler(mx.routeHTTP)
 		h = mx.chainHandler(h)
+		meta = mx.meta
+	}
+	if mx.api {
+		meta = meta.Merge(Meta{MetaAPI: true})
 	}
 
 	// Add the endpoint to the tree and return the node
 	if mx.api {
 		if pattern == "/" {
 			for _, ext := range mx.ApiExtensions {
-				nodes = append(nodes, mx.tree.InsertRoute(mx.overrides, method, "/."+ext, h, mx.headers))
+				nodes = append(nodes, mx.tree.InsertRouteCb(mx.overrides, method, "/."+ext, mx.constraints, meta, h, nil))
 			}
 		} else {
 			for _, ext := range mx.ApiExtensions {
-				nodes = append(nodes, mx.tree.InsertRoute(mx.overrides, method, pattern+"."+ext, h, mx.headers))
+				nodes = append(nodes, mx.tree.InsertRouteCb(mx.overrides, method, pattern+"."+ext, mx.constraints, meta, h, nil))
 			}
 		}
 	}
-	nodes = append(nodes, mx.tree.InsertRoute(mx.overrides, method, pattern, h, mx.headers))
+	nodes = append(nodes, mx.tree.InsertRouteCb(mx.overrides, method, pattern, mx.constraints, meta, h, nil))
 	return
 }
 
@@ -718,10 +858,11 @@ func (mx *Mux) FindHandler(method, path string, header ...http.Header) ContextHa
 		if h := h.Handler(header...); h != nil {
 			if mh, ok := h.(*MountHandler); ok {
 				if finder, ok := mh.Handler.(HandlerFinder); ok {
-					return finder.FindHandler(path, method)
+					return finder.FindHandler(method, path, header...)
 				}
 				return mh
 			}
+			return h
 		}
 	}
 	return nil
@@ -740,6 +881,23 @@ func (mx *Mux) routeHTTP(w http.ResponseWriter, r *http.Request, rctx *RouteCont
 		}
 	}
 
+	// Redirect or rewrite the request
+	if mx.Rules != nil && mx.Rules.apply(w, r, rctx, &routePath) {
+		return
+	}
+
+	// The metadata of the router applies to all of its routes
+	rctx.Meta = rctx.Meta.Merge(mx.meta)
+
+	// Read the requested API version
+	if mx.versioned && rctx.APIVersion == "" {
+		versioning := mx.Versioning
+		if versioning == nil {
+			versioning = DefaultVersioning
+		}
+		routePath = versioning.resolve(w, r, rctx, routePath)
+	}
+
 	// Check if method is supported by chi
 	if rctx.RouteMethod == "" {
 		rctx.RouteMethod = r.Method
@@ -758,14 +916,9 @@ func (mx *Mux) routeHTTP(w http.ResponseWriter, r *http.Request, rctx *RouteCont
 			handlerChain := Chain(mx.handlerInterseptors.Items...).Handler(h)
 			handlerChain.ServeHTTPContext(w, r, rctx)
 		} else if eh, ok := h.(*EndpointHandler); ok {
-			if ehh := eh.find(r.Header); ehh == nil {
-				w.WriteHeader(http.StatusBadRequest)
-			} else {
-				rctx.Handler = ehh.handler
-				ehh.handler.ServeHTTPContext(w, r, rctx)
-			}
+			eh.ServeHTTPContext(w, r, rctx)
 		} else {
-			h.ServeHTTPContext(w, r, rctx)
+			serveEndpoint(h, w, r, rctx)
 		}
 		return
 	}
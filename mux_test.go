@@ -10,7 +10,12 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -1520,6 +1525,531 @@ func TestRouteApi(t *testing.T) {
 	}
 }
 
+func TestMuxConstraints(t *testing.T) {
+	text := func(s string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(s))
+		}
+	}
+
+	r := NewRouter()
+	r.Query(url.Values{"format": []string{"csv", "tsv"}}, func(r Router) {
+		r.Get("/report", text("csv"))
+		r.Cookies(url.Values{"beta": []string{"1"}}, func(r Router) {
+			r.Get("/report", text("csv beta"))
+		})
+	})
+	r.When("admin", func(r *http.Request, rctx *RouteContext) bool {
+		return r.Header.Get("X-Role") == "admin"
+	}, func(r Router) {
+		r.With(func(chain *ChainHandler) {
+			chain.Writer.Header().Set("X-Admin", "1")
+			chain.Next()
+		}).Get("/report", text("admin"))
+	})
+	r.Route("/v2", func(r Router) {
+		r.Headers(http.Header{"Accept": []string{"text/csv"}}, func(r Router) {
+			r.Get("/report", text("v2 csv"))
+		})
+	})
+
+	tests := []struct {
+		query  string
+		header http.Header
+		cookie string
+		status int
+		body   string
+	}{
+		{query: "?format=csv", status: 200, body: "csv"},
+		{query: "?format=tsv", status: 200, body: "csv"},
+		{query: "?format=csv", cookie: "1", status: 200, body: "csv beta"},
+		{query: "?format=csv", header: http.Header{"X-Role": []string{"admin"}}, status: 200, body: "csv"},
+		{header: http.Header{"X-Role": []string{"admin"}}, status: 200, body: "admin"},
+		{query: "?format=xml", status: 400},
+		{status: 400},
+	}
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i, tt := range tests {
+		req, _ := http.NewRequest("GET", ts.URL+"/report"+tt.query, nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "beta", Value: tt.cookie})
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || string(body) != tt.body {
+			t.Fatalf("input [%d]: expecting %d %q, got %d %q", i, tt.status, tt.body, resp.StatusCode, body)
+		}
+	}
+
+	r.ConstraintMismatch(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(406)
+		w.Write([]byte("not acceptable"))
+	})
+	if resp, body := testRequest(t, ts, "GET", "/report", nil); resp.StatusCode != 406 || body != "not acceptable" {
+		t.Fatalf("expecting 406, got %d %q", resp.StatusCode, body)
+	}
+	if resp, body := testRequest(t, ts, "GET", "/v2/report", nil); resp.StatusCode != 406 || body != "not acceptable" {
+		t.Fatalf("expecting 406 from the subrouter, got %d %q", resp.StatusCode, body)
+	}
+
+	var routes []string
+	WalkEndpoints(r, func(method string, route string, v EndpointVariant, middlewares ...*Middleware) error {
+		routes = append(routes, method+" "+route+" "+v.Constraints.String())
+		return nil
+	})
+	sort.Strings(routes)
+	expected := []string{
+		"GET /report [?format=csv|tsv cookie:beta=1]",
+		"GET /report [?format=csv|tsv]",
+		"GET /report [if:admin]",
+		"GET /v2/*/report [Accept=text/csv]",
+	}
+	if !stringSliceEqual(routes, expected) {
+		t.Fatalf("expecting routes %q, got %q", expected, routes)
+	}
+}
+
+func TestMuxVersions(t *testing.T) {
+	text := func(s string) func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		return func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+			w.Write([]byte(s + " (" + rctx.APIVersion + ")"))
+		}
+	}
+
+	deprecated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := NewRouter()
+	r.Versioning = &Versioning{
+		PathPrefix: true,
+		Header:     "Accept-Version",
+		Vendor:     "x",
+		Deprecations: map[string]Deprecation{
+			"1": {At: deprecated, Sunset: sunset, Link: "https://example.com/v1"},
+		},
+	}
+	r.Get("/ping", text("pong"))
+	r.Version("1", func(r Router) {
+		r.Get("/users/{id}", text("user v1"))
+		r.Get("/legacy", text("legacy v1"))
+	})
+	r.Version("2", func(r Router) {
+		r.Get("/users/{id}", text("user v2"))
+	})
+
+	tests := []struct {
+		path       string
+		header     http.Header
+		status     int
+		body       string
+		deprecated bool
+	}{
+		{path: "/v1/users/7", status: 200, body: "user v1 (1)", deprecated: true},
+		{path: "/v2/users/7", status: 200, body: "user v2 (2)"},
+		{path: "/v3/users/7", status: 200, body: "user v2 (3)"},
+		{path: "/users/7", status: 200, body: "user v2 ()"},
+		{path: "/users/7", header: http.Header{"Accept-Version": []string{"1"}}, status: 200, body: "user v1 (1)", deprecated: true},
+		{path: "/users/7", header: http.Header{"Accept": []string{"text/html, application/vnd.x.v1+json"}}, status: 200, body: "user v1 (1)", deprecated: true},
+		{path: "/users/7", header: http.Header{"Accept": []string{"application/vnd.y.v1+json"}}, status: 200, body: "user v2 ()"},
+		{path: "/v2/users/7", header: http.Header{"Accept-Version": []string{"1"}}, status: 200, body: "user v2 (2)"},
+		{path: "/v2/legacy", status: 200, body: "legacy v1 (2)"},
+		{path: "/v0/users/7", status: 400},
+		{path: "/v2/ping", status: 200, body: "pong (2)"},
+	}
+
+	for i, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Fatalf("input [%d]: %s expecting %d %q, got %d %q", i, tt.path, tt.status, tt.body, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Deprecation"); (got != "") != tt.deprecated {
+			t.Fatalf("input [%d]: %s unexpected Deprecation header %q", i, tt.path, got)
+		}
+		if tt.deprecated {
+			if got := w.Header().Get("Deprecation"); got != "@1704067200" {
+				t.Fatalf("input [%d]: bad Deprecation header %q", i, got)
+			}
+			if got := w.Header().Get("Sunset"); got != "Wed, 01 Jan 2025 00:00:00 GMT" {
+				t.Fatalf("input [%d]: bad Sunset header %q", i, got)
+			}
+			if got := w.Header().Get("Link"); got != `<https://example.com/v1>; rel="deprecation"` {
+				t.Fatalf("input [%d]: bad Link header %q", i, got)
+			}
+		}
+	}
+}
+
+func TestMuxFindHandlerConstraints(t *testing.T) {
+	r := NewRouter()
+	r.Version("1", func(r Router) {
+		r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	r.When("admin", func(r *http.Request, rctx *RouteContext) bool {
+		return r.Header.Get("X-Role") == "admin"
+	}, func(r Router) {
+		r.Get("/report", func(w http.ResponseWriter, r *http.Request) {})
+	})
+
+	if h := r.FindHandler("GET", "/users/{id}", http.Header{}); h == nil {
+		t.Fatal("versioned handler not found")
+	}
+	if h := r.FindHandler("GET", "/report", http.Header{"X-Role": []string{"admin"}}); h == nil {
+		t.Fatal("predicate handler not found")
+	}
+	if h := r.FindHandler("GET", "/report", http.Header{}); h != nil {
+		t.Fatal("predicate handler found without the header")
+	}
+}
+
+func TestMuxMeta(t *testing.T) {
+	perm := func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		w.Write([]byte(rctx.Meta.String("owner") + " " + rctx.Meta.String("perm")))
+	}
+
+	r := NewRouter()
+	r.Use(Meta{"owner": "core"})
+	r.Get("/ping", perm)
+	r.With(Meta{"perm": "users.read"}).Get("/users/{id}", perm)
+	r.Group(func(r Router) {
+		r.Use(Meta{"perm": "users.write"})
+		r.Post("/users", perm)
+		r.With(Meta{"perm": "users.delete"}).Delete("/users/{id}", perm)
+	})
+	r.With(Meta{"perm": "admin"}).Route("/admin", func(r Router) {
+		r.Use(Meta{"owner": "ops"})
+		r.Get("/stats", perm)
+		r.With(Meta{"perm": "admin.jobs"}).Get("/jobs", perm)
+	})
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", "/ping", "core "},
+		{"GET", "/users/1", "core users.read"},
+		{"POST", "/users", "core users.write"},
+		{"DELETE", "/users/1", "core users.delete"},
+		{"GET", "/admin/stats", "ops admin"},
+		{"GET", "/admin/jobs", "ops admin.jobs"},
+	}
+	for i, tt := range tests {
+		if _, body := testHandler(t, r, tt.method, tt.path, nil); body != tt.body {
+			t.Fatalf("input [%d]: %s %s expecting %q, got %q", i, tt.method, tt.path, tt.body, body)
+		}
+	}
+
+	// the request metadata doesn't alias the metadata of the routers
+	touch := NewRouter()
+	touch.Use(Meta{"owner": "core"})
+	touch.Get("/touch", func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		perm(w, r, rctx)
+		rctx.Meta["owner"] = "changed"
+	})
+	for i := 0; i < 2; i++ {
+		if _, body := testHandler(t, touch, "GET", "/touch", nil); body != "core " {
+			t.Fatalf("request [%d]: expecting %q, got %q", i, "core ", body)
+		}
+	}
+
+	for _, route := range r.Routes() {
+		if route.Pattern == "/users/{id}" {
+			if route.Meta["GET"].String("perm") != "users.read" || route.Meta["DELETE"].String("perm") != "users.delete" {
+				t.Fatalf("unexpected route metadata %v", route.Meta)
+			}
+		}
+	}
+
+	walked := map[string]string{}
+	WalkEndpoints(r, func(method string, route string, v EndpointVariant, middlewares ...*Middleware) error {
+		walked[method+" "+route] = v.Meta.String("owner") + " " + v.Meta.String("perm")
+		return nil
+	})
+	expected := map[string]string{
+		"GET /ping":          "core ",
+		"GET /users/{id}":    "core users.read",
+		"POST /users":        "core users.write",
+		"DELETE /users/{id}": "core users.delete",
+		"GET /admin/*/stats": "ops admin",
+		"GET /admin/*/jobs":  "ops admin.jobs",
+	}
+	if !reflect.DeepEqual(walked, expected) {
+		t.Fatalf("expecting walked metadata %v, got %v", expected, walked)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	tp := MustTrustedProxies("10.0.0.0/8", "::1")
+
+	tests := []struct {
+		remote string
+		header http.Header
+		ip     string
+		scheme string
+		host   string
+	}{
+		{"1.2.3.4:5000", http.Header{"X-Forwarded-For": {"9.9.9.9"}}, "1.2.3.4", "http", "example.com"},
+		{"10.0.0.1:5000", http.Header{"X-Forwarded-For": {"9.9.9.9"}}, "9.9.9.9", "http", "example.com"},
+		{"10.0.0.1:5000", http.Header{"X-Forwarded-For": {"6.6.6.6, 9.9.9.9, 10.0.0.2"}, "X-Forwarded-Proto": {"https"},
+			"X-Forwarded-Host": {"api.example.com"}}, "9.9.9.9", "https", "api.example.com"},
+		{"10.0.0.1:5000", http.Header{"X-Forwarded-For": {"10.0.0.3", "10.0.0.2"}}, "10.0.0.3", "http", "example.com"},
+		{"10.0.0.1:5000", http.Header{"X-Forwarded-For": {"bad, 10.0.0.2"}}, "10.0.0.1", "http", "example.com"},
+		{"[::1]:5000", http.Header{"X-Real-Ip": {"2001:db8::1"}, "X-Forwarded-Proto": {"https"}}, "2001:db8::1", "https", "example.com"},
+		{"10.0.0.1:5000", http.Header{"Forwarded": {`for=6.6.6.6;proto=http, for="[2001:db8::1]:4711";proto=https;host=www.example.com`},
+			"X-Forwarded-For": {"7.7.7.7"}}, "2001:db8::1", "https", "www.example.com"},
+		{"10.0.0.1:5000", http.Header{"X-Forwarded-For": {"9.9.9.9"}, "X-Forwarded-Host": {"evil.com/x"}}, "9.9.9.9", "http", "example.com"},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		r.Header = tt.header
+		if ip, scheme, host := tp.Resolve(r); ip != tt.ip || scheme != tt.scheme || host != tt.host {
+			t.Fatalf("input [%d]: expecting %s %s %s, got %s %s %s", i, tt.ip, tt.scheme, tt.host, ip, scheme, host)
+		}
+	}
+
+	if _, err := NewTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Fatalf("expecting bad CIDR error")
+	}
+
+	r := NewRouter()
+	r.TrustedProxies = tp
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		u, _ := rctx.URLFor("/users/{id}/{tab?}", map[string]string{"id": rctx.URLParam("id")})
+		w.Write([]byte(rctx.ClientIP + " " + u))
+	})
+	req := httptest.NewRequest("GET", "/users/7", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if body := w.Body.String(); body != "9.9.9.9 https://example.com/users/7" {
+		t.Fatalf("unexpected response %q", body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var outbound string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outbound = r.Header.Get(RequestIDHeader)
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: &RequestIDTransport{}}
+
+	r := NewRouter()
+	r.RequestIDs = &RequestIDs{}
+	r.Get("/", func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL, nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		w.Write([]byte(rctx.RequestID))
+	})
+
+	tests := []struct {
+		header http.Header
+		id     string
+	}{
+		{http.Header{"X-Request-Id": {"abc-123"}}, "abc-123"},
+		{http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{http.Header{"X-Request-Id": {"bad id"}}, ""},
+		{http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"}}, ""},
+		{nil, ""},
+	}
+	seen := map[string]bool{}
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		id := w.Body.String()
+		if tt.id != "" && id != tt.id || tt.id == "" && (len(id) != 32 || seen[id]) {
+			t.Fatalf("input [%d]: expecting %q, got %q", i, tt.id, id)
+		}
+		seen[id] = true
+		if h := w.Header().Get(RequestIDHeader); h != id {
+			t.Fatalf("input [%d]: expecting response header %q, got %q", i, id, h)
+		}
+		if outbound != id {
+			t.Fatalf("input [%d]: expecting outbound %q, got %q", i, id, outbound)
+		}
+	}
+}
+
+func TestBufferedWriter(t *testing.T) {
+	r := NewRouter()
+	r.Use(ResponseRewriter(20, func(bw *BufferedWriter, r *http.Request, rctx *RouteContext) {
+		switch {
+		case bw.Status() == http.StatusNotFound:
+			bw.Header().Set("Content-Type", "text/html")
+			bw.SetBody([]byte("<h1>gone</h1>"))
+		case bw.Header().Get("Content-Type") == "text/html":
+			bw.SetStatus(http.StatusAccepted)
+			bw.SetBody(bytes.Replace(bw.Body(), []byte("</body>"), []byte("<script/></body>"), 1))
+		}
+	}))
+	r.Get("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "13")
+		w.Write([]byte("<body></body>"))
+		if ws := w.(ResponseWriter); ws.Status() != 200 || ws.BytesWritten() != 13 {
+			t.Fatalf("expecting status 200 and 13 bytes, got %d %d", ws.Status(), ws.BytesWritten())
+		}
+	})
+	r.Get("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	r.Get("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<body>0123456789</body>"))
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/page", 202, "<body><script/></body>"},
+		{"/missing", 404, "<h1>gone</h1>"},
+		{"/big", 200, "<body>0123456789</body>"},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status || w.Body.String() != tt.body {
+			t.Fatalf("input [%d]: expecting %d %q, got %d %q", i, tt.status, tt.body, w.Code, w.Body.String())
+		}
+		if cl := w.Header().Get("Content-Length"); cl != "" && cl != strconv.Itoa(len(tt.body)) {
+			t.Fatalf("input [%d]: expecting Content-Length %d, got %s", i, len(tt.body), cl)
+		}
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := NewRouter()
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Write(body)
+	}
+	r.With(BodyLimit(4)).Post("/small", echo)
+	r.Post("/big", echo)
+
+	tests := []struct {
+		path, body string
+		chunked    bool
+		status     int
+	}{
+		{"/small", "1234", false, 200},
+		{"/small", "12345", false, 413},
+		{"/small", "1234", true, 200},
+		{"/small", "12345", true, 413},
+		{"/big", "12345", false, 200},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+		if tt.chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || tt.status == 200 && w.Body.String() != tt.body {
+			t.Fatalf("input [%d]: expecting %d, got %d %q", i, tt.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`[
+		{"match": "/blog/{year}/{slug}", "target": "/posts/{slug}", "status": 301},
+		{"match": "/docs/{path...}", "target": "https://docs.example.com/{path...}", "status": 308},
+		{"match": "/api/v1/{path...}", "target": "/api/v2/{path...}"},
+		{"match": "/old-search", "methods": ["GET"], "target": "/search", "method": "POST"},
+		{"match": "/self", "target": "/self", "status": 302},
+		{"match": "/ping", "target": "/pong"},
+		{"match": "/pong", "target": "/ping"},
+		{"match": "/old/{path...}", "target": "/{path...}", "status": 301},
+		{"match": "/files/{name}", "target": "/assets/{name}", "status": 301},
+		{"match": "/same/{name}", "target": "/same/{name}", "status": 302},
+		{"match": "/old-users/{name}", "target": "/users/{name}"}
+	]`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRouter()
+	r.Rules = rules
+	r.Get("/api/v2/*", func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		w.Write([]byte("v2 " + rctx.URLParam("*")))
+	})
+	r.Post("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("search " + r.Method))
+	})
+	r.Get("/users/{name}", func(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+		w.Write([]byte("user " + rctx.URLParam("name")))
+	})
+	r.NotFound(http.NotFound)
+
+	tests := []struct {
+		method, path string
+		status       int
+		location     string
+		body         string
+	}{
+		{"GET", "/blog/2020/hello?ref=x", 301, "/posts/hello?ref=x", ""},
+		{"GET", "/docs/guide/install", 308, "https://docs.example.com/guide/install", ""},
+		{"GET", "/api/v1/users/7", 200, "", "v2 users/7"},
+		{"GET", "/old-search", 200, "", "search GET"},
+		{"POST", "/old-search", 404, "", ""},
+		{"GET", "/self", 508, "", ""},
+		{"GET", "/ping", 508, "", ""},
+		{"GET", "/old//evil.com", 301, "/evil.com", ""},
+		{"GET", "/old/%2Fevil.com", 301, "/evil.com", ""},
+		{"GET", "/files/a%2Fb", 301, "/assets/a%2Fb", ""},
+		{"GET", "/files/100%25", 301, "/assets/100%25", ""},
+		{"GET", "/same/a%20b", 508, "", ""},
+		{"GET", "/users/a%20b", 200, "", "user a b"},
+		{"GET", "/old-users/a%20b", 200, "", "user a b"},
+		{"GET", "/users/a%2Fb", 200, "", "user a%2Fb"},
+		{"GET", "/old-users/a%2Fb", 200, "", "user a%2Fb"},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status || w.Header().Get("Location") != tt.location || tt.body != "" && w.Body.String() != tt.body {
+			t.Fatalf("input [%d]: expecting %d %q %q, got %d %q %q", i, tt.status, tt.location, tt.body,
+				w.Code, w.Header().Get("Location"), w.Body.String())
+		}
+	}
+
+	if _, err := NewRules(&Rule{Match: "/a", Target: "/b", Status: 200}); err == nil {
+		t.Fatalf("expecting bad status error")
+	}
+	if _, err := NewRules(&Rule{Match: "/a", Target: "http://b"}); err == nil {
+		t.Fatalf("expecting bad rewrite target error")
+	}
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader) (*http.Response, string) {
 	req, err := http.NewRequest(method, ts.URL+path, body)
 	if err != nil {
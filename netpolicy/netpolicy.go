@@ -0,0 +1,167 @@
+// Package netpolicy implements the network policies of xroute: CIDR allow and
+// deny lists of client IP addresses, attached to route subtrees.
+//
+// The client IP is the one resolved by the router from the trusted proxies
+// (see xroute.TrustedProxies):
+//
+//	vpn := netpolicy.MustNew(netpolicy.Lists{Allow: []string{"10.8.0.0/16", "fd00:8::/32"}})
+//	r.Route("/admin", func(r xroute.Router) {
+//		r.Use(vpn.Middleware())
+//		...
+//	})
+//
+// Lists can be reloaded from a source, such as a file, while serving:
+//
+//	stop, err := vpn.Watch(&netpolicy.FileSource{Path: "/etc/app/admin-ips"})
+//
+// Denied requests are replied 403 through xroute.ServeError, unless the
+// policy is in dry run mode, that only logs them.
+package netpolicy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+var ErrForbidden = errors.New("netpolicy: client address not allowed")
+
+// Lists are the allow and deny lists of CIDR ranges or IP addresses.
+type Lists struct {
+	Allow []string
+	Deny  []string
+}
+
+type nets struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (l Lists) parse() (n nets, err error) {
+	if n.allow, err = parseCIDRs(l.Allow); err == nil {
+		n.deny, err = parseCIDRs(l.Deny)
+	}
+	return
+}
+
+func parseCIDRs(cidrs []string) (nets []*net.IPNet, err error) {
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("netpolicy: bad CIDR %q: %v", cidr, err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy is a network policy. Addresses of the deny list are denied, and if
+// the allow list isn't empty, the addresses out of it too.
+type Policy struct {
+	// Name is the middleware name. Empty is an anonymous middleware, so
+	// many policies can be attached to the same router.
+	Name string
+
+	// DryRun logs the denied requests, without denying them.
+	DryRun bool
+
+	// OnReloadError is called when a watched source fails to load. The
+	// previous lists are kept.
+	OnReloadError func(err error)
+
+	mu   sync.RWMutex
+	nets nets
+}
+
+// New returns a new policy of the lists.
+func New(lists Lists) (*Policy, error) {
+	p := &Policy{}
+	if err := p.SetLists(lists); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MustNew is like New, but panics on errors.
+func MustNew(lists Lists) *Policy {
+	p, err := New(lists)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// SetLists replaces the lists of the policy.
+func (p *Policy) SetLists(lists Lists) error {
+	n, err := lists.parse()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.nets = n
+	p.mu.Unlock()
+	return nil
+}
+
+// Allowed reports whether the IP address `ip` is allowed.
+func (p *Policy) Allowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if contains(p.nets.deny, parsed) {
+		return false
+	}
+	return len(p.nets.allow) == 0 || contains(p.nets.allow, parsed)
+}
+
+// Middleware returns the policy middleware.
+func (p *Policy) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: p.Name, Handler: p.Handler}
+}
+
+// Handler is the policy middleware handler.
+func (p *Policy) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	ip := rctx.ClientIP
+	if ip == "" {
+		if ip, _, _ = net.SplitHostPort(r.RemoteAddr); ip == "" {
+			ip = r.RemoteAddr
+		}
+	}
+	if p.Allowed(ip) {
+		chain.Next()
+		return
+	}
+	if p.DryRun {
+		if rctx.Log != nil {
+			rctx.Log.Warningf("netpolicy: dry run: %s %s denied to %s", r.Method, r.URL.Path, ip)
+		}
+		chain.Next()
+		return
+	}
+	xroute.ServeError(chain.Writer, r, rctx, xroute.NewHTTPError(http.StatusForbidden, ErrForbidden))
+}
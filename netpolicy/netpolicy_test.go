@@ -0,0 +1,134 @@
+package netpolicy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func newRouter(p *Policy) *xroute.Mux {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	r := xroute.NewRouter()
+	r.TrustedProxies = xroute.MustTrustedProxies("127.0.0.1")
+	r.Get("/", ok)
+	r.Route("/admin", func(r xroute.Router) {
+		r.Use(p.Middleware())
+		r.Get("/users", ok)
+	})
+	return r
+}
+
+func status(h http.Handler, path, client string) int {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", client)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestPolicy(t *testing.T) {
+	p := MustNew(Lists{Allow: []string{"10.8.0.0/16", "fd00:8::/32"}, Deny: []string{"10.8.66.6"}})
+	r := newRouter(p)
+
+	tests := []struct {
+		path, client string
+		status       int
+	}{
+		{"/", "1.2.3.4", 200},
+		{"/admin/users", "1.2.3.4", 403},
+		{"/admin/users", "10.8.1.1", 200},
+		{"/admin/users", "10.8.66.6", 403},
+		{"/admin/users", "fd00:8::1", 200},
+		{"/admin/users", "fd00:9::1", 403},
+	}
+	for i, tt := range tests {
+		if s := status(r, tt.path, tt.client); s != tt.status {
+			t.Fatalf("input [%d]: %s from %s expecting %d, got %d", i, tt.path, tt.client, tt.status, s)
+		}
+	}
+
+	p.DryRun = true
+	if s := status(r, "/admin/users", "1.2.3.4"); s != 200 {
+		t.Fatalf("expecting dry run to allow, got %d", s)
+	}
+
+	if _, err := New(Lists{Deny: []string{"10.0.0.0/40"}}); err == nil {
+		t.Fatalf("expecting bad CIDR error")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin-ips")
+	write := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# VPN\nallow 10.8.0.0/16\n")
+
+	p := &Policy{}
+	reloadErrs := make(chan error, 10)
+	p.OnReloadError = func(err error) { reloadErrs <- err }
+	stop, err := p.Watch(&FileSource{Path: path, Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	r := newRouter(p)
+
+	if s := status(r, "/admin/users", "10.8.1.1"); s != 200 {
+		t.Fatalf("expecting allowed, got %d", s)
+	}
+
+	write("allow 10.8.0.0/16\ndeny 10.8.1.1 # lost laptop\n")
+	for i := 0; status(r, "/admin/users", "10.8.1.1") != 403; i++ {
+		if i == 200 {
+			t.Fatalf("expecting reloaded lists")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// bad files keep the previous lists
+	write("allow 10.8.0.0/16\nblock 10.8.1.2 and more\n")
+	select {
+	case <-reloadErrs:
+	case <-time.After(time.Second):
+		t.Fatalf("expecting reload error")
+	}
+	if s := status(r, "/admin/users", "10.8.1.1"); s != 403 {
+		t.Fatalf("expecting previous lists, got %d", s)
+	}
+
+	// files without allow rules don't allow every address
+	write("# truncated\n")
+	select {
+	case err := <-reloadErrs:
+		if err != ErrNoAllow {
+			t.Fatalf("expecting ErrNoAllow, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expecting reload error")
+	}
+	if s := status(r, "/admin/users", "192.0.2.1"); s != 403 {
+		t.Fatalf("expecting previous lists, got %d", s)
+	}
+
+	write("allow all\ndeny 10.8.1.1\n")
+	for i := 0; status(r, "/admin/users", "192.0.2.1") != 200; i++ {
+		if i == 200 {
+			t.Fatalf("expecting reloaded lists")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s := status(r, "/admin/users", "10.8.1.1"); s != 403 {
+		t.Fatalf("expecting denied, got %d", s)
+	}
+}
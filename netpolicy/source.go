@@ -0,0 +1,136 @@
+package netpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source is a source of lists.
+type Source interface {
+	// Load returns the lists.
+	Load() (Lists, error)
+
+	// Watch calls `changed` when the lists change, until stopped.
+	Watch(changed func()) (stop func(), err error)
+}
+
+// ErrNoAllow is returned by the loads of watched sources without allow rules.
+var ErrNoAllow = errors.New("netpolicy: source without allow rules")
+
+// Watch sets the lists of the source, and reloads them on changes. The lists
+// of watched sources must have allow rules, so an empty or partially written
+// source doesn't allow every address: such loads fail with ErrNoAllow, and the
+// previous lists are kept. Sources allowing every address must do it
+// explicitly, such as with `allow all` in files.
+func (p *Policy) Watch(src Source) (stop func(), err error) {
+	if err = p.reload(src); err != nil {
+		return nil, err
+	}
+	return src.Watch(func() {
+		if err := p.reload(src); err != nil && p.OnReloadError != nil {
+			p.OnReloadError(err)
+		}
+	})
+}
+
+func (p *Policy) reload(src Source) error {
+	lists, err := src.Load()
+	if err != nil {
+		return err
+	}
+	if len(lists.Allow) == 0 {
+		return ErrNoAllow
+	}
+	return p.SetLists(lists)
+}
+
+// FileSource reads the lists of a file, a rule per line, with `#` comments:
+//
+//	# VPN
+//	allow 10.8.0.0/16
+//	allow fd00:8::/32
+//	deny 10.8.66.6
+//
+// `allow all` allows every address, so the deny list only restricts them.
+// The file is watched by polling its modification time and size.
+type FileSource struct {
+	Path string
+
+	// Interval is the polling interval. Defaults to 5 seconds.
+	Interval time.Duration
+}
+
+func (fs *FileSource) Load() (lists Lists, err error) {
+	data, err := ioutil.ReadFile(fs.Path)
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if pos := strings.IndexByte(text, '#'); pos != -1 {
+			text = text[:pos]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return Lists{}, fmt.Errorf("netpolicy: %s:%d: bad rule %q", fs.Path, line, strings.TrimSpace(text))
+		}
+		switch fields[0] {
+		case "allow":
+			if fields[1] == "all" {
+				lists.Allow = append(lists.Allow, "0.0.0.0/0", "::/0")
+			} else {
+				lists.Allow = append(lists.Allow, fields[1])
+			}
+		case "deny":
+			lists.Deny = append(lists.Deny, fields[1])
+		default:
+			return Lists{}, fmt.Errorf("netpolicy: %s:%d: bad rule %q", fs.Path, line, strings.TrimSpace(text))
+		}
+	}
+	return lists, scanner.Err()
+}
+
+func (fs *FileSource) Watch(changed func()) (stop func(), err error) {
+	info, err := os.Stat(fs.Path)
+	if err != nil {
+		return nil, err
+	}
+	interval := fs.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		modTime, size := info.ModTime(), info.Size()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if info, err := os.Stat(fs.Path); err == nil && (!info.ModTime().Equal(modTime) || info.Size() != size) {
+				modTime, size = info.ModTime(), info.Size()
+				changed()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}, nil
+}
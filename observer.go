@@ -0,0 +1,119 @@
+package xroute
+
+import "net/http"
+
+// StepKind is the kind of a request handling step.
+type StepKind uint8
+
+const (
+	// StepRouter is a router (Mux) handling the request.
+	StepRouter StepKind = iota
+	// StepMiddleware is a middleware handler call.
+	StepMiddleware
+	// StepEndpoint is the endpoint handler call.
+	StepEndpoint
+)
+
+func (k StepKind) String() string {
+	switch k {
+	case StepRouter:
+		return "router"
+	case StepMiddleware:
+		return "middleware"
+	default:
+		return "endpoint"
+	}
+}
+
+// Step is a request handling step.
+type Step struct {
+	Kind StepKind
+
+	// Router is set on StepRouter steps.
+	Router Router
+	// Middleware is set on StepMiddleware steps.
+	Middleware *Middleware
+	// Handler is set on StepEndpoint steps.
+	Handler interface{}
+
+	Writer  ResponseWriter
+	Request *http.Request
+	Context *RouteContext
+}
+
+// Observer is notified when a request handling step begins. If the returned
+// function is not nil, it is called when the step ends.
+//
+// Observers are registered into RouteContext.Observers, usually by a
+// middleware, and observe the next steps of the request.
+type Observer interface {
+	Begin(step *Step) (end func())
+}
+
+// ObserverFunc is an Observer function.
+type ObserverFunc func(step *Step) (end func())
+
+func (f ObserverFunc) Begin(step *Step) func() {
+	return f(step)
+}
+
+// Observe registers the observer for the next steps of the request.
+func (x *RouteContext) Observe(o Observer) {
+	x.Observers = append(x.Observers, o)
+}
+
+func noopEnd() {}
+
+func (x *RouteContext) begin(kind StepKind, value interface{}, w http.ResponseWriter, r *http.Request) func() {
+	if x == nil || len(x.Observers) == 0 {
+		return noopEnd
+	}
+
+	step := &Step{Kind: kind, Request: r, Context: x}
+	step.Writer, _ = w.(ResponseWriter)
+	switch kind {
+	case StepRouter:
+		step.Router = value.(Router)
+	case StepMiddleware:
+		step.Middleware = value.(*Middleware)
+	default:
+		step.Handler = value
+	}
+
+	var ends []func()
+	for _, o := range x.Observers {
+		if end := o.Begin(step); end != nil {
+			ends = append(ends, end)
+		}
+	}
+	return func() {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i]()
+		}
+	}
+}
+
+// routingHandler is the mux routing handler. It isn't an endpoint.
+type routingHandler struct {
+	ContextHandler
+}
+
+// serveEndpoint serves the endpoint handler `h`, notifying the observers.
+// Handlers that dispatch to other handlers aren't observed, the dispatched
+// handler is.
+func serveEndpoint(h ContextHandler, w http.ResponseWriter, r *http.Request, rctx *RouteContext) {
+	if isEndpoint(h) {
+		defer rctx.begin(StepEndpoint, h, w, r)()
+	}
+	h.ServeHTTPContext(w, r, rctx)
+}
+
+func isEndpoint(h ContextHandler) bool {
+	switch ht := h.(type) {
+	case *HttpContextHandler:
+		return isEndpoint(ht.ContextHandler)
+	case *ChainHandler, *routingHandler, *EndpointHandler, EndpointHandler, *MountHandler, *Mux:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package xroute
+
+// PrincipalKey is the RouteContext.Data key of the authenticated principal.
+var PrincipalKey = &contextKey{"Principal"}
+
+// Principal is the authenticated identity of a request, set by the
+// authentication middlewares and read by the authorization.
+type Principal struct {
+	// ID identifies the principal, such as the user name or the API key
+	// name.
+	ID string
+
+	// Roles are the role names of the principal.
+	Roles []string
+
+	// Permissions are the permissions granted to the principal directly,
+	// besides the ones of its roles.
+	Permissions []string
+
+	// Attributes are the principal attributes, such as the JWT claims, for
+	// attribute based policies.
+	Attributes map[string]interface{}
+
+	// Scheme is the authentication scheme, such as Basic or Bearer.
+	Scheme string
+}
+
+// HasRole reports whether the principal has any of the `roles`.
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if containsString(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal returns the authenticated principal of the request, or nil.
+func (x *RouteContext) Principal() *Principal {
+	p, _ := x.Data[PrincipalKey].(*Principal)
+	return p
+}
+
+// SetPrincipal sets the authenticated principal of the request.
+func (x *RouteContext) SetPrincipal(p *Principal) {
+	x.Data[PrincipalKey] = p
+}
@@ -0,0 +1,209 @@
+package xroute
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIPName is the name of the middleware of TrustedProxies.Middleware.
+const RealIPName = "realip"
+
+// TrustedProxies resolves the client IP, scheme and host of the requests
+// forwarded by trusted proxies, from the Forwarded, X-Forwarded-For,
+// X-Forwarded-Proto, X-Forwarded-Host and X-Real-IP headers. The headers of
+// requests from other addresses are ignored.
+//
+// The client IP is the nearest address of the forwarding chain that isn't a
+// trusted proxy, so clients can't spoof it by sending the headers.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies returns the trusted proxies of the CIDR ranges or IP
+// addresses, such as 10.0.0.0/8 or ::1.
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	tp := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %q: %v", cidr, err)
+		}
+		tp.nets = append(tp.nets, ipnet)
+	}
+	return tp, nil
+}
+
+// MustTrustedProxies is like NewTrustedProxies, but panics on errors.
+func MustTrustedProxies(cidrs ...string) *TrustedProxies {
+	tp, err := NewTrustedProxies(cidrs...)
+	if err != nil {
+		panic(err)
+	}
+	return tp
+}
+
+// Trusted reports whether `ip` is a trusted proxy address.
+func (tp *TrustedProxies) Trusted(ip string) bool {
+	if tp == nil {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipnet := range tp.nets {
+		if ipnet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the client IP, scheme and host of the request.
+func (tp *TrustedProxies) Resolve(r *http.Request) (ip, scheme, host string) {
+	ip = hostOnly(r.RemoteAddr)
+	scheme, host = "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !tp.Trusted(ip) {
+		return
+	}
+
+	if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+		elements := parseForwarded(forwarded)
+		if i := tp.client(len(elements), func(i int) string { return elements[i]["for"] }); i >= 0 {
+			e := elements[i]
+			ip = hostOnly(e["for"])
+			if validScheme(e["proto"]) {
+				scheme = strings.ToLower(e["proto"])
+			}
+			if validHost(e["host"]) {
+				host = e["host"]
+			}
+		}
+		return
+	}
+
+	if xff := splitHeader(r.Header.Values("X-Forwarded-For")); len(xff) > 0 {
+		i := tp.client(len(xff), func(i int) string { return xff[i] })
+		if i < 0 {
+			return
+		}
+		ip = hostOnly(xff[i])
+		// the proto and host of the hop, or the ones of the nearest proxy
+		valueOf := func(name string) string {
+			values := splitHeader(r.Header.Values(name))
+			switch {
+			case len(values) == len(xff):
+				return values[i]
+			case len(values) > 0:
+				return values[len(values)-1]
+			}
+			return ""
+		}
+		if proto := valueOf("X-Forwarded-Proto"); validScheme(proto) {
+			scheme = strings.ToLower(proto)
+		}
+		if h := valueOf("X-Forwarded-Host"); validHost(h) {
+			host = h
+		}
+		return
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		ip = realIP
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); validScheme(proto) {
+		scheme = strings.ToLower(proto)
+	}
+	if h := r.Header.Get("X-Forwarded-Host"); validHost(h) {
+		host = h
+	}
+	return
+}
+
+// client returns the index of the client address of the forwarding chain of
+// `n` addresses: the rightmost one that isn't trusted, or the leftmost one. It
+// returns -1 if an address before the client is invalid.
+func (tp *TrustedProxies) client(n int, addr func(i int) string) int {
+	for i := n - 1; i >= 0; i-- {
+		ip := hostOnly(addr(i))
+		if net.ParseIP(ip) == nil {
+			return -1
+		}
+		if i == 0 || !tp.Trusted(ip) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Middleware returns the named middleware that sets the client IP, scheme and
+// host of the route context (see RouteContext.ClientIP). Routers resolve them
+// with their TrustedProxies field, so the middleware is only required for
+// handlers served out of routers.
+func (tp *TrustedProxies) Middleware() *Middleware {
+	return &Middleware{Name: RealIPName, Handler: func(chain *ChainHandler) {
+		r := chain.Request()
+		chain.Context.ClientIP, chain.Context.Scheme, chain.Context.Host = tp.Resolve(r)
+		chain.Context.Forwarded = tp.Trusted(hostOnly(r.RemoteAddr))
+		chain.Next()
+	}}
+}
+
+// parseForwarded parses the elements of the Forwarded headers (RFC 7239),
+// with lower case parameter names.
+func parseForwarded(values []string) (elements []map[string]string) {
+	for _, element := range splitHeader(values) {
+		params := map[string]string{}
+		for _, pair := range strings.Split(element, ";") {
+			if pos := strings.IndexByte(pair, '='); pos > 0 {
+				params[strings.ToLower(strings.TrimSpace(pair[:pos]))] = strings.Trim(strings.TrimSpace(pair[pos+1:]), `"`)
+			}
+		}
+		elements = append(elements, params)
+	}
+	return
+}
+
+func splitHeader(values []string) (items []string) {
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return
+}
+
+// hostOnly returns the address without the port and the IPv6 brackets.
+func hostOnly(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+func validScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "http", "https", "ws", "wss":
+		return true
+	}
+	return false
+}
+
+func validHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, "/\\ @?#")
+}
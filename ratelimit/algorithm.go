@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket is the token bucket algorithm: the bucket holds up to Burst
+// tokens and is refilled with Limit tokens per Period. Each request takes a
+// token. A Limit or Period not greater than zero denies every request.
+type TokenBucket struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// NewTokenBucket returns a token bucket of `limit` requests per `period`.
+// If `burst` is zero, the bucket capacity is `limit`.
+func NewTokenBucket(limit int, period time.Duration, burst int) *TokenBucket {
+	if burst <= 0 {
+		burst = limit
+	}
+	return &TokenBucket{Limit: limit, Period: period, Burst: burst}
+}
+
+func (tb *TokenBucket) Take(store Store, key string, now time.Time) (res Result) {
+	if tb.Limit <= 0 || tb.Period <= 0 {
+		// the bucket is never refilled
+		return Result{Limit: tb.Burst}
+	}
+	rate := float64(tb.Limit) / tb.Period.Seconds() // tokens per second
+	capacity := float64(tb.Burst)
+	ttl := time.Duration(capacity / rate * float64(time.Second))
+
+	store.Update(key, ttl, func(s *State) {
+		if s.Time.IsZero() {
+			s.Tokens = capacity
+		} else if elapsed := now.Sub(s.Time).Seconds(); elapsed > 0 {
+			s.Tokens = math.Min(capacity, s.Tokens+elapsed*rate)
+		}
+		s.Time = now
+
+		if s.Tokens >= 1 {
+			s.Tokens--
+			res.Allowed = true
+		} else {
+			res.RetryAfter = duration((1 - s.Tokens) / rate)
+		}
+		res.Limit = tb.Burst
+		res.Remaining = int(math.Floor(s.Tokens))
+		res.Reset = duration((capacity - s.Tokens) / rate)
+	})
+	return
+}
+
+// SlidingWindow is the sliding window counter algorithm: at most Limit
+// requests are allowed in any Window. The count of the previous fixed window
+// is weighted by its overlap with the sliding window. A Window not greater
+// than zero denies every request.
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+}
+
+// NewSlidingWindow returns a sliding window of `limit` requests per `window`.
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{Limit: limit, Window: window}
+}
+
+func (sw *SlidingWindow) Take(store Store, key string, now time.Time) (res Result) {
+	if sw.Window <= 0 {
+		return Result{Limit: sw.Limit}
+	}
+	start := now.Truncate(sw.Window)
+
+	store.Update(key, 2*sw.Window, func(s *State) {
+		if !s.Time.Equal(start) {
+			if s.Time.Equal(start.Add(-sw.Window)) {
+				s.PrevCount = s.Count
+			} else {
+				s.PrevCount = 0
+			}
+			s.Count = 0
+			s.Time = start
+		}
+
+		elapsed := now.Sub(start)
+		weight := 1 - float64(elapsed)/float64(sw.Window)
+		estimated := float64(s.PrevCount)*weight + float64(s.Count)
+
+		res.Limit = sw.Limit
+		res.Reset = start.Add(sw.Window).Sub(now)
+
+		if estimated+1 <= float64(sw.Limit) {
+			s.Count++
+			res.Allowed = true
+			res.Remaining = int(math.Floor(float64(sw.Limit) - estimated - 1))
+			return
+		}
+
+		if s.Count+1 > sw.Limit || s.PrevCount == 0 {
+			// wait for the next window
+			res.RetryAfter = res.Reset
+		} else {
+			// wait until the previous window weight is low enough
+			need := time.Duration(float64(sw.Window) * (1 - float64(sw.Limit-s.Count-1)/float64(s.PrevCount)))
+			res.RetryAfter = need - elapsed
+			if res.RetryAfter > res.Reset {
+				res.RetryAfter = res.Reset
+			}
+		}
+	})
+	return
+}
+
+func duration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
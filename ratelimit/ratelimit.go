@@ -0,0 +1,172 @@
+// Package ratelimit implements a rate limiting middleware for xroute, with
+// token bucket and sliding window algorithms.
+//
+// Limits are keyed by route pattern, client IP, header values or custom
+// keys. Attach limiters with With or Group to give different subtrees
+// different quotas:
+//
+//	search := ratelimit.New(ratelimit.NewSlidingWindow(100, time.Minute),
+//		ratelimit.KeyByRoute, ratelimit.KeyByHeader("X-Api-Key"))
+//	r.With(search.Middleware()).Get("/api/v1/search", doSearch)
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Result is the result of a rate limit check.
+type Result struct {
+	// Allowed reports whether the request is allowed.
+	Allowed bool
+
+	// Limit is the request quota.
+	Limit int
+
+	// Remaining is the number of requests remaining in the quota.
+	Remaining int
+
+	// Reset is the time until the quota is fully restored.
+	Reset time.Duration
+
+	// RetryAfter is the time until the next request is allowed. It is only
+	// set if the request is not allowed.
+	RetryAfter time.Duration
+}
+
+// Algorithm is a rate limit algorithm.
+type Algorithm interface {
+	// Take consumes a request of `key`.
+	Take(store Store, key string, now time.Time) Result
+}
+
+// KeyFunc returns the rate limit key of the request. If ok is false, the
+// request is not limited.
+type KeyFunc func(r *http.Request, rctx *xroute.RouteContext) (key string, ok bool)
+
+// KeyByRoute keys by the matched route pattern. The pattern is only known
+// after routing, so the limiter must be attached with With or Group.
+func KeyByRoute(r *http.Request, rctx *xroute.RouteContext) (string, bool) {
+	if rctx == nil {
+		return "", true
+	}
+	return r.Method + " " + rctx.RoutePattern(), true
+}
+
+// KeyByIP keys by the client IP address, as resolved by the router (see
+// xroute.TrustedProxies).
+func KeyByIP(r *http.Request, rctx *xroute.RouteContext) (string, bool) {
+	if rctx != nil && rctx.ClientIP != "" {
+		return rctx.ClientIP, true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host, true
+}
+
+// KeyByHeader keys by the value of the request header `name`. Requests
+// without the header are not limited.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request, rctx *xroute.RouteContext) (string, bool) {
+		v := r.Header.Get(name)
+		return v, v != ""
+	}
+}
+
+// Keys composes key functions. Requests are not limited if any of the
+// functions returns false.
+func Keys(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request, rctx *xroute.RouteContext) (string, bool) {
+		parts := make([]string, len(fns))
+		for i, fn := range fns {
+			key, ok := fn(r, rctx)
+			if !ok {
+				return "", false
+			}
+			parts[i] = key
+		}
+		return strings.Join(parts, "|"), true
+	}
+}
+
+// Limiter is the rate limit middleware.
+type Limiter struct {
+	// Name prefixes the store keys, so limiters can share a store.
+	Name string
+
+	Algorithm Algorithm
+	Store     Store
+	Key       KeyFunc
+
+	// LimitedHandler replies to limited requests. The default handler
+	// replies 429 Too Many Requests.
+	LimitedHandler xroute.ContextHandler
+
+	now func() time.Time
+}
+
+// New returns a new limiter with an in-memory store. If no key functions are
+// given, requests are keyed by route pattern and client IP.
+func New(algorithm Algorithm, keys ...KeyFunc) *Limiter {
+	if len(keys) == 0 {
+		keys = []KeyFunc{KeyByRoute, KeyByIP}
+	}
+	return &Limiter{
+		Algorithm: algorithm,
+		Store:     NewMemoryStore(),
+		Key:       Keys(keys...),
+		now:       time.Now,
+	}
+}
+
+// Middleware returns the rate limit middleware.
+func (l *Limiter) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Handler: l.Handler}
+}
+
+// Handler is the rate limit middleware handler.
+func (l *Limiter) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	key, ok := l.Key(r, rctx)
+	if !ok {
+		chain.Next()
+		return
+	}
+	if l.Name != "" {
+		key = l.Name + ":" + key
+	}
+
+	res := l.Algorithm.Take(l.Store, key, l.now())
+
+	header := chain.Writer.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+
+	if res.Allowed {
+		chain.Next()
+		return
+	}
+
+	header.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+	if l.LimitedHandler != nil {
+		l.LimitedHandler.ServeHTTPContext(chain.Writer, r, rctx)
+		return
+	}
+	http.Error(chain.Writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
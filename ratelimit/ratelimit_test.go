@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tb := NewTokenBucket(2, time.Second, 4)
+	store := NewMemoryStore()
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 4; i++ {
+		if res := tb.Take(store, "k", now); !res.Allowed || res.Remaining != 3-i {
+			t.Fatalf("request %d: unexpected result %+v", i, res)
+		}
+	}
+	res := tb.Take(store, "k", now)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected limited request, got %+v", res)
+	}
+	if res = tb.Take(store, "k", now.Add(500*time.Millisecond)); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected refilled token, got %+v", res)
+	}
+	if res = tb.Take(store, "other", now); !res.Allowed {
+		t.Fatalf("keys must be independent, got %+v", res)
+	}
+
+	for _, tb := range []*TokenBucket{NewTokenBucket(0, time.Second, 0), NewTokenBucket(2, 0, 4), NewTokenBucket(-1, time.Second, 4)} {
+		if res := tb.Take(store, "bad", now); res.Allowed || res.RetryAfter != 0 || res.Reset != 0 {
+			t.Fatalf("expected %+v to deny every request, got %+v", tb, res)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	sw := NewSlidingWindow(4, time.Minute)
+	store := NewMemoryStore()
+	start := time.Unix(600, 0) // window aligned
+
+	for i := 0; i < 4; i++ {
+		if res := sw.Take(store, "k", start.Add(time.Duration(i)*time.Second)); !res.Allowed {
+			t.Fatalf("request %d: unexpected result %+v", i, res)
+		}
+	}
+	res := sw.Take(store, "k", start.Add(30*time.Second))
+	if res.Allowed || res.RetryAfter != 30*time.Second {
+		t.Fatalf("expected limited request, got %+v", res)
+	}
+
+	// 15s in the next window: previous window weight is 0.75, 4*0.75 = 3
+	if res = sw.Take(store, "k", start.Add(75*time.Second)); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected allowed request, got %+v", res)
+	}
+	// 3 + 1 requests: wait until weight drops to 0.5 (at 30s)
+	if res = sw.Take(store, "k", start.Add(75*time.Second)); res.Allowed || res.RetryAfter != 15*time.Second {
+		t.Fatalf("expected limited request, got %+v", res)
+	}
+	if res = sw.Take(store, "k", start.Add(90*time.Second)); !res.Allowed {
+		t.Fatalf("expected allowed request, got %+v", res)
+	}
+	if res := NewSlidingWindow(2, 0).Take(store, "bad", start); res.Allowed {
+		t.Fatalf("expected zero window to deny every request, got %+v", res)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	search := New(NewTokenBucket(2, time.Minute, 0), KeyByRoute, KeyByHeader("X-Api-Key"))
+	search.now = func() time.Time { return now }
+	admin := New(NewSlidingWindow(1, time.Minute))
+	admin.now = search.now
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+
+	r := xroute.NewRouter()
+	r.With(search.Middleware()).Get("/api/v1/search", ok)
+	r.With(search.Middleware()).Get("/api/v1/items/{id}", ok)
+	r.Group(func(r xroute.Router) {
+		r.Use(admin.Middleware())
+		r.Get("/admin", ok)
+	})
+
+	do := func(path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-Api-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do("/api/v1/search", "a"); w.Code != 200 || w.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+		}
+	}
+	w := do("/api/v1/search", "a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 429, got %d %v", w.Code, w.Header())
+	}
+
+	// other key, other route pattern and requests without key have their own quota
+	if w = do("/api/v1/search", "b"); w.Code != 200 {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	for _, id := range []string{"1", "2"} {
+		if w = do("/api/v1/items/"+id, "a"); w.Code != 200 {
+			t.Fatalf("unexpected status %d", w.Code)
+		}
+	}
+	if w = do("/api/v1/items/3", "a"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for route pattern quota, got %d", w.Code)
+	}
+	if w = do("/api/v1/search", ""); w.Code != 200 || w.Header().Get("RateLimit-Limit") != "" {
+		t.Fatalf("request without key must not be limited: %d %v", w.Code, w.Header())
+	}
+
+	if w = do("/admin", ""); w.Code != 200 {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if w = do("/admin", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	if key, _ := KeyByIP(r, nil); key != "10.0.0.1" {
+		t.Fatalf("expecting remote address key, got %q", key)
+	}
+	rctx := xroute.NewRouteContext()
+	rctx.ClientIP = "9.9.9.9"
+	if key, _ := KeyByIP(r, rctx); key != "9.9.9.9" {
+		t.Fatalf("expecting client IP key, got %q", key)
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the rate limit state of a key.
+type State struct {
+	// Time is the last update time for token buckets, and the current window
+	// start for sliding windows.
+	Time time.Time
+
+	Tokens    float64
+	Count     int
+	PrevCount int
+}
+
+// Store holds the rate limit states.
+type Store interface {
+	// Update calls `fn` with the state of `key` (zero for new or expired
+	// keys), atomically, and keeps the state for `ttl`.
+	Update(key string, ttl time.Duration, fn func(s *State))
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// MemoryStore is an in-memory Store. Expired states are removed
+// periodically.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	ops     int
+	now     func() time.Time
+}
+
+// NewMemoryStore returns a new in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, now: time.Now}
+}
+
+const memoryStoreGCInterval = 1024
+
+func (ms *MemoryStore) Update(key string, ttl time.Duration, fn func(s *State)) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := ms.now()
+
+	if ms.ops++; ms.ops >= memoryStoreGCInterval {
+		ms.ops = 0
+		for k, e := range ms.entries {
+			if now.After(e.expires) {
+				delete(ms.entries, k)
+			}
+		}
+	}
+
+	e, ok := ms.entries[key]
+	if !ok || now.After(e.expires) {
+		e = &memoryEntry{}
+		ms.entries[key] = e
+	}
+	fn(&e.state)
+	e.expires = now.Add(ttl)
+}
+
+// Len returns the number of stored keys.
+func (ms *MemoryStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.entries)
+}
@@ -0,0 +1,136 @@
+package xroute
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/moisespsena-go/xroute/internal/traceparent"
+)
+
+const (
+	// RequestIDName is the name of the middleware of RequestIDs.Middleware.
+	RequestIDName = "request_id"
+
+	// RequestIDHeader is the default header of the request IDs.
+	RequestIDHeader = "X-Request-ID"
+)
+
+// RequestIDs sets the request ID of the requests (see RouteContext.RequestID),
+// and echoes it in the response header. The ID is the one sent by the client
+// in the header, the trace ID of the W3C `traceparent` header, or a new one.
+//
+// Routers set the IDs with their RequestIDs field, so the logs of the request
+// (see RouteContext.Log) are prefixed by them. Outbound calls propagate them
+// with RequestIDTransport.
+type RequestIDs struct {
+	// Header is the request and response header of the IDs. Defaults to
+	// RequestIDHeader.
+	Header string
+
+	// IgnoreIncoming ignores the IDs sent by the clients, so a new one is
+	// always generated.
+	IgnoreIncoming bool
+
+	// Generate returns a new ID. Defaults to a random 128 bit hex string.
+	Generate func() string
+}
+
+func (ids *RequestIDs) header() string {
+	if ids.Header == "" {
+		return RequestIDHeader
+	}
+	return ids.Header
+}
+
+// Resolve returns the request ID of the request.
+func (ids *RequestIDs) Resolve(r *http.Request) string {
+	if !ids.IgnoreIncoming {
+		if id := strings.TrimSpace(r.Header.Get(ids.header())); validRequestID(id) {
+			return id
+		}
+		if id := traceID(r.Header.Get("traceparent")); id != "" {
+			return id
+		}
+	}
+	if ids.Generate != nil {
+		return ids.Generate()
+	}
+	return NewRequestID()
+}
+
+// Middleware returns the named middleware that sets the request ID of the
+// route context, if not set yet. Routers set the IDs with their RequestIDs
+// field, so the middleware is only required for handlers served out of
+// routers.
+func (ids *RequestIDs) Middleware() *Middleware {
+	return &Middleware{Name: RequestIDName, Handler: func(chain *ChainHandler) {
+		r, rctx := chain.Request(), chain.Context
+		rctx.resolveRequestID(chain.Writer, r, ids)
+		if rctx.Log == nil {
+			rctx.Log = RequestLoggerFactory(r, rctx)
+		}
+		chain.Next()
+	}}
+}
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// validRequestID reports whether the ID sent by a client is safe to be logged
+// and echoed: up to 128 visible ASCII characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// traceID returns the trace ID of the `traceparent` header value, or empty if
+// it's invalid.
+func traceID(value string) string {
+	if id, _, _, ok := traceparent.Parse(value); ok {
+		return hex.EncodeToString(id[:])
+	}
+	return ""
+}
+
+// RequestIDTransport is a http.RoundTripper that propagates the request ID of
+// the route context of the outbound requests context:
+//
+//	client := &http.Client{Transport: &xroute.RequestIDTransport{}}
+//	req, _ := http.NewRequestWithContext(r.Context(), "GET", "http://api/items", nil)
+//	res, err := client.Do(req)
+type RequestIDTransport struct {
+	// Base is the underlying round tripper. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Header is the header of the IDs. Defaults to RequestIDHeader.
+	Header string
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base, header := t.Base, t.Header
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if header == "" {
+		header = RequestIDHeader
+	}
+	if rctx := RouteContextFromContext(req.Context()); rctx != nil && rctx.RequestID != "" && req.Header.Get(header) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(header, rctx.RequestID)
+	}
+	return base.RoundTrip(req)
+}
@@ -29,7 +29,10 @@
 //
 package xroute
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+)
 
 // NewRouter returns a new Mux object that implements the Router interface.
 func NewRouter() *Mux {
@@ -108,7 +111,13 @@ type Router interface {
 	Put(pattern string, h interface{})
 	Trace(pattern string, h interface{})
 
+	// Routes constraints, on top of the method and pattern. See Constraints.
 	Headers(headers http.Header, f func(r Router))
+	Query(values url.Values, f func(r Router))
+	Cookies(values url.Values, f func(r Router))
+	When(name string, match func(r *http.Request, rctx *RouteContext) bool, f func(r Router))
+	Constrain(constraints Constraints, f func(r Router))
+	Version(version string, f func(r Router))
 	Api(f func(r Router))
 
 	// NotFound defines a handler to respond whenever a route could
@@ -119,6 +128,10 @@ type Router interface {
 	// not allowed.
 	MethodNotAllowed(h interface{})
 
+	// ConstraintMismatch defines a handler to respond whenever a route
+	// matches, but none of its handlers constraints.
+	ConstraintMismatch(h interface{})
+
 	Overrides(f func(r Router))
 }
 
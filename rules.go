@@ -0,0 +1,267 @@
+package xroute
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrRuleLoop is replied when the rules rewrite or redirect a request in a
+// loop.
+var ErrRuleLoop = NewHTTPError(http.StatusLoopDetected, errors.New("xroute: rules loop"))
+
+// DefaultMaxRewrites is the default limit of the rewrites of a request.
+const DefaultMaxRewrites = 10
+
+// Rule is a redirect or rewrite rule. It matches the request path with a
+// route pattern, and substitutes the params into the target pattern:
+//
+//	{"match": "/blog/{year}/{slug}", "target": "/posts/{slug}", "status": 301}
+//	{"match": "/api/v1/{path...}", "target": "/api/v2/{path...}"}
+//
+// The params are decoded, and escaped again in the target. Targets beginning
+// with more than one slash, such as `//example.com` of the `/{path...}`
+// target, are reduced to a single slash, so they stay on the same host.
+type Rule struct {
+	// Match is the route pattern of the request paths.
+	Match string `json:"match" yaml:"match"`
+
+	// Methods are the methods of the requests. Empty matches any method.
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+
+	// Target is the target pattern. Redirect targets are absolute paths or
+	// URLs, and rewrite targets are paths of the router.
+	Target string `json:"target" yaml:"target"`
+
+	// Status is the redirect status: 301, 302, 307 or 308. Zero rewrites
+	// the request internally: it's routed again with the target path.
+	Status int `json:"status,omitempty" yaml:"status,omitempty"`
+
+	// Method is the method of the rewritten requests. Empty keeps the
+	// request method.
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+}
+
+// IsRewrite reports whether the rule rewrites the requests internally.
+func (rule *Rule) IsRewrite() bool {
+	return rule.Status == 0
+}
+
+func (rule *Rule) String() string {
+	methods := "*"
+	if len(rule.Methods) > 0 {
+		methods = strings.Join(rule.Methods, ",")
+	}
+	action := strconv.Itoa(rule.Status)
+	if rule.IsRewrite() {
+		action = "REWRITE"
+		if rule.Method != "" {
+			action += " " + rule.Method
+		}
+	}
+	return methods + " " + rule.Match + " -> " + action + " " + rule.Target
+}
+
+func (rule *Rule) validate() error {
+	switch rule.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("xroute: rule %q: bad redirect status %d", rule.Match, rule.Status)
+	}
+	if !strings.HasPrefix(rule.Match, "/") {
+		return fmt.Errorf("xroute: rule %q: the pattern must begin with '/'", rule.Match)
+	}
+	if rule.IsRewrite() && !strings.HasPrefix(rule.Target, "/") {
+		return fmt.Errorf("xroute: rule %q: the rewrite target %q must be a path", rule.Match, rule.Target)
+	}
+	for _, method := range append(rule.Methods, rule.Method) {
+		if _, ok := methodMap[strings.ToUpper(method)]; method != "" && !ok {
+			return fmt.Errorf("xroute: rule %q: bad method %q", rule.Match, method)
+		}
+	}
+	return nil
+}
+
+// ruleHandler is the tree handler of a rule.
+type ruleHandler struct {
+	rule *Rule
+}
+
+func (rh *ruleHandler) ServeHTTPContext(w http.ResponseWriter, r *http.Request, rctx *RouteContext) {}
+
+// Rules are redirect and rewrite rules, applied by the routers before
+// routing (see Mux.Rules). Rules are matched like routes: the most specific
+// pattern wins, and the last rule of the same pattern and method overrides
+// the previous ones.
+type Rules struct {
+	// MaxRewrites is the limit of the rewrites of a request. Defaults to
+	// DefaultMaxRewrites.
+	MaxRewrites int
+
+	rules []*Rule
+	tree  *node
+}
+
+// NewRules returns the rules.
+func NewRules(rules ...*Rule) (*Rules, error) {
+	rs := &Rules{tree: &node{}}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if len(rule.Methods) == 0 {
+			rs.tree.InsertRoute(true, ALL, rule.Match, &ruleHandler{rule})
+		}
+		for _, method := range rule.Methods {
+			rs.tree.InsertRoute(true, methodMap[strings.ToUpper(method)], rule.Match, &ruleHandler{rule})
+		}
+		rs.rules = append(rs.rules, rule)
+	}
+	return rs, nil
+}
+
+// MustRules is like NewRules, but panics on errors.
+func MustRules(rules ...*Rule) *Rules {
+	rs, err := NewRules(rules...)
+	if err != nil {
+		panic(err)
+	}
+	return rs
+}
+
+// ParseRules parses the rules of `data`, a list of rules, with `unmarshal`.
+// If `unmarshal` is nil, `data` is JSON. xroute does not decode YAML: to
+// parse YAML, or any other format, the caller must pass the unmarshal
+// function of its own decoder, such as yaml.Unmarshal of gopkg.in/yaml.v3:
+//
+//	rules, err := xroute.ParseRules(data, yaml.Unmarshal)
+func ParseRules(data []byte, unmarshal func(data []byte, v interface{}) error) (*Rules, error) {
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	var rules []*Rule
+	if err := unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("xroute: parse rules: %v", err)
+	}
+	return NewRules(rules...)
+}
+
+// LoadRules parses the rules of the file `path` (see ParseRules). The file
+// is JSON if `unmarshal` is nil, whatever its extension.
+func LoadRules(path string, unmarshal func(data []byte, v interface{}) error) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data, unmarshal)
+}
+
+// Rules returns the rules, in the given order.
+func (rs *Rules) Rules() []*Rule {
+	return rs.rules
+}
+
+// Match returns the rule matching the method and the escaped path, and its
+// target with the params substituted. It returns a nil rule if none matches.
+func (rs *Rules) Match(method, path string) (*Rule, string, error) {
+	m, ok := methodMap[method]
+	if !ok {
+		return nil, "", nil
+	}
+	rctx := NewRouteContext()
+	_, _, h := rs.tree.FindRoute(rctx, m, path, http.Header{})
+	rh, ok := h.(*ruleHandler)
+	if !ok {
+		return nil, "", nil
+	}
+	params := make(map[string]string, len(rctx.routeParams.Keys))
+	for i, key := range rctx.routeParams.Keys {
+		// BuildPath escapes the values
+		value, err := url.PathUnescape(rctx.routeParams.Values[i])
+		if err != nil {
+			return nil, "", err
+		}
+		params[key] = value
+	}
+	target, err := BuildPath(rh.rule.Target, params)
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		target = "/" + strings.TrimLeft(target, "/\\")
+	}
+	return rh.rule, target, nil
+}
+
+// apply applies the rules to the request. Rewrites update the route path
+// and method of `rctx`. It returns whether the request was replied, by a
+// redirect or an error.
+func (rs *Rules) apply(w http.ResponseWriter, r *http.Request, rctx *RouteContext, routePath *string) bool {
+	max := rs.MaxRewrites
+	if max <= 0 {
+		max = DefaultMaxRewrites
+	}
+	method := rctx.RouteMethod
+	if method == "" {
+		method = r.Method
+	}
+	// the rules match the escaped path, but the route path is escaped only
+	// if the request, or the rewrite target, has a raw path
+	raw := r.URL.RawPath != ""
+	if rctx.rewritten {
+		raw = rctx.rewrittenRaw
+	}
+	path := *routePath
+	if !raw {
+		path = (&url.URL{Path: path}).EscapedPath()
+	}
+	seen := map[string]bool{method + " " + path: true}
+
+	for rewrites := 0; ; rewrites++ {
+		rule, target, err := rs.Match(method, path)
+		switch {
+		case err != nil:
+			ServeError(w, r, rctx, NewHTTPError(http.StatusInternalServerError, err))
+			return true
+		case rule == nil:
+			return false
+		case !rule.IsRewrite():
+			if target == r.URL.EscapedPath() {
+				ServeError(w, r, rctx, ErrRuleLoop)
+				return true
+			}
+			if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, rule.Status)
+			return true
+		}
+
+		if rule.Method != "" {
+			method = strings.ToUpper(rule.Method)
+		}
+		key := method + " " + target
+		if seen[key] || rewrites == max {
+			ServeError(w, r, rctx, ErrRuleLoop)
+			return true
+		}
+		seen[key] = true
+		// route the target as the path of a request to it: unescaped,
+		// unless that loses its escaping
+		routed, err := url.PathUnescape(target)
+		raw = err != nil || (&url.URL{Path: routed}).EscapedPath() != target
+		if raw {
+			routed = target
+		}
+		path, *routePath, rctx.RoutePath, rctx.RouteMethod = target, routed, routed, method
+		rctx.rewritten, rctx.rewrittenRaw = true, raw
+		if rctx.Log != nil {
+			rctx.Log.Debugf("rewrite %s %s -> %s %s", r.Method, r.URL.Path, method, routed)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package session implements the request sessions of xroute, stored in
+// signed or encrypted cookies, or server side.
+//
+// The sessions are loaded lazily: the middleware only prepares the session of
+// the request, which is loaded from the store on the first Get, so routes that
+// never use the session pay nothing. Modified sessions are saved before the
+// response header is written.
+//
+//	sessions := session.New(session.NewMemoryStore())
+//	sessions.IdleTimeout = 30 * time.Minute
+//	r.Use(sessions.Middleware())
+//	r.Route("/api", func(r xroute.Router) {
+//		r.Use(xroute.Meta{session.MetaKey: false})
+//		...
+//	})
+//
+//	func login(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+//		s, err := session.Get(rctx)
+//		...
+//		s.RenewID()
+//		s.Set("user", user.ID)
+//		s.AddFlash("Welcome back!")
+//	}
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the session middleware.
+const Name = "session"
+
+// MetaKey is the route metadata key that disables the sessions of the routes,
+// if false.
+const MetaKey = "session"
+
+const flashKey = "_flash"
+
+var (
+	ErrNoSession = errors.New("session: no session middleware")
+	ErrDisabled  = errors.New("session: disabled by the route")
+)
+
+// Session is a request session. Values must be JSON encodable and read back
+// as decoded by encoding/json.
+type Session struct {
+	ID       string                 `json:"id"`
+	Values   map[string]interface{} `json:"values,omitempty"`
+	Created  time.Time              `json:"created"`
+	Accessed time.Time              `json:"accessed"`
+
+	modified  bool
+	destroyed bool
+	renewed   *Session
+}
+
+func newSession(now time.Time) *Session {
+	return &Session{ID: newID(), Values: map[string]interface{}{}, Created: now, Accessed: now}
+}
+
+// Get returns the value of `key`, or nil.
+func (s *Session) Get(key string) interface{} {
+	return s.Values[key]
+}
+
+// Set sets the value of `key`.
+func (s *Session) Set(key string, value interface{}) {
+	s.Values[key] = value
+	s.modified = true
+}
+
+// Delete deletes the value of `key`.
+func (s *Session) Delete(key string) {
+	if _, ok := s.Values[key]; ok {
+		delete(s.Values, key)
+		s.modified = true
+	}
+}
+
+// AddFlash adds a flash message, kept until read by Flashes.
+func (s *Session) AddFlash(msg string) {
+	s.Set(flashKey, append(s.flashes(), msg))
+}
+
+// Flashes returns and removes the flash messages.
+func (s *Session) Flashes() []string {
+	flashes := s.flashes()
+	s.Delete(flashKey)
+	return flashes
+}
+
+func (s *Session) flashes() (flashes []string) {
+	switch v := s.Values[flashKey].(type) {
+	case []string:
+		flashes = append(flashes, v...)
+	case []interface{}:
+		for _, item := range v {
+			if msg, ok := item.(string); ok {
+				flashes = append(flashes, msg)
+			}
+		}
+	}
+	return
+}
+
+// RenewID changes the session ID, keeping the values. It should be called on
+// login and privilege changes to prevent session fixation.
+func (s *Session) RenewID() {
+	if s.renewed == nil {
+		old := *s
+		s.renewed = &old
+	}
+	s.ID = newID()
+	s.modified = true
+}
+
+// Destroy deletes the session and its cookie.
+func (s *Session) Destroy() {
+	s.destroyed = true
+}
+
+func newID() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Manager is the session middleware.
+type Manager struct {
+	Store Store
+
+	// The session cookie attributes. The cookie name defaults to
+	// `session`.
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+
+	// IdleTimeout, if not zero, expires the sessions not used for the
+	// duration.
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout, if not zero, expires the sessions created the
+	// duration ago.
+	AbsoluteTimeout time.Duration
+
+	now func() time.Time
+}
+
+// New returns a new session manager of `store`.
+func New(store Store) *Manager {
+	return &Manager{
+		Store:      store,
+		CookieName: "session",
+		Path:       "/",
+		SameSite:   http.SameSiteLaxMode,
+		now:        time.Now,
+	}
+}
+
+type stateKey struct{}
+
+// state is the lazily loaded session of a request.
+type state struct {
+	m       *Manager
+	r       *http.Request
+	rctx    *xroute.RouteContext
+	session *Session
+	err     error
+}
+
+// Get returns the session of the request, loading it on the first call. A new
+// session is returned if the request has none, or it expired.
+func Get(rctx *xroute.RouteContext) (*Session, error) {
+	st, ok := rctx.Data[stateKey{}].(*state)
+	if !ok {
+		return nil, ErrNoSession
+	}
+	if enabled, ok := rctx.Meta[MetaKey].(bool); ok && !enabled {
+		return nil, ErrDisabled
+	}
+	if st.session == nil && st.err == nil {
+		st.session, st.err = st.m.load(st.r)
+	}
+	return st.session, st.err
+}
+
+func (m *Manager) load(r *http.Request) (*Session, error) {
+	now := m.now()
+	cookie, err := r.Cookie(m.CookieName)
+	if err != nil {
+		return newSession(now), nil
+	}
+	s, err := m.Store.Load(cookie.Value)
+	if err != nil || s == nil {
+		return newSession(now), err
+	}
+	if m.expired(s, now) {
+		m.Store.Delete(s)
+		return newSession(now), nil
+	}
+	if s.Values == nil {
+		s.Values = map[string]interface{}{}
+	}
+	if m.IdleTimeout > 0 {
+		// rolling idle expiration
+		s.Accessed = now
+		s.modified = true
+	}
+	return s, nil
+}
+
+func (m *Manager) expired(s *Session, now time.Time) bool {
+	return (m.IdleTimeout > 0 && now.Sub(s.Accessed) > m.IdleTimeout) ||
+		(m.AbsoluteTimeout > 0 && now.Sub(s.Created) > m.AbsoluteTimeout)
+}
+
+// ttl returns the time to live of the session, or zero if it doesn't
+// expire.
+func (m *Manager) ttl(s *Session, now time.Time) time.Duration {
+	ttl := m.IdleTimeout
+	if m.AbsoluteTimeout > 0 {
+		if left := s.Created.Add(m.AbsoluteTimeout).Sub(now); ttl == 0 || left < ttl {
+			ttl = left
+		}
+	}
+	return ttl
+}
+
+// commit saves the session of the request, if it was loaded and modified.
+func (st *state) commit(w http.ResponseWriter) error {
+	s, m := st.session, st.m
+	if s == nil {
+		return nil
+	}
+	st.session = nil
+	st.err = errors.New("session: used after the response header was written")
+
+	cookie := &http.Cookie{
+		Name:     m.CookieName,
+		Path:     m.Path,
+		Domain:   m.Domain,
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: m.SameSite,
+	}
+	if s.renewed != nil {
+		if err := m.Store.Delete(s.renewed); err != nil {
+			return err
+		}
+	}
+	if s.destroyed {
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+		return m.Store.Delete(s)
+	}
+	if !s.modified {
+		return nil
+	}
+
+	now := m.now()
+	ttl := m.ttl(s, now)
+	value, err := m.Store.Save(s, ttl)
+	if err != nil {
+		return err
+	}
+	cookie.Value = value
+	if ttl > 0 {
+		cookie.MaxAge = int(ttl / time.Second)
+		cookie.Expires = now.Add(ttl)
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// Middleware returns the named session middleware.
+func (m *Manager) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: m.Handler}
+}
+
+// Handler is the session middleware handler.
+func (m *Manager) Handler(chain *xroute.ChainHandler) {
+	rctx := chain.Context
+	if _, ok := rctx.Data[stateKey{}]; ok {
+		chain.Next()
+		return
+	}
+	st := &state{m: m, r: chain.Request(), rctx: rctx}
+	rctx.Data[stateKey{}] = st
+	w := &writer{ResponseWriter: chain.Writer, state: st}
+	chain.Next(xroute.ResponseWriter(w))
+	w.commit()
+}
+
+// writer saves the session before the response header is written.
+type writer struct {
+	xroute.ResponseWriter
+	state     *state
+	committed bool
+}
+
+func (w *writer) commit() {
+	if !w.committed {
+		w.committed = true
+		if err := w.state.commit(w.ResponseWriter); err != nil && w.state.rctx.Log != nil {
+			w.state.rctx.Log.Errorf("session: save failed: %v", err)
+		}
+	}
+}
+
+func (w *writer) WriteHeader(code int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *writer) Flush() {
+	w.commit()
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+type client struct {
+	h       http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (c *client) get(path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(c.cookies, cookie.Name)
+		} else {
+			c.cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+func newRouter(m *Manager) *xroute.Mux {
+	r := xroute.NewRouter()
+	r.Use(m.Middleware())
+	r.Get("/login", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		s, _ := Get(rctx)
+		s.RenewID()
+		s.Set("user", "ann")
+		s.AddFlash("welcome")
+	})
+	r.Get("/me", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		s, _ := Get(rctx)
+		user, ok := s.Get("user").(string)
+		if !ok {
+			w.WriteHeader(500)
+			return
+		}
+		w.Write([]byte(s.ID + " " + strings.Join(append([]string{user}, s.Flashes()...), ",")))
+	})
+	r.Get("/logout", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		s, _ := Get(rctx)
+		s.Destroy()
+	})
+	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+	r.Route("/api", func(r xroute.Router) {
+		r.Use(xroute.Meta{MetaKey: false})
+		r.Get("/me", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+			if _, err := Get(rctx); err != ErrDisabled {
+				w.WriteHeader(500)
+			}
+		})
+	})
+	return r
+}
+
+func TestServerSession(t *testing.T) {
+	store := NewMemoryStore()
+	c := &client{h: newRouter(New(store)), cookies: map[string]*http.Cookie{}}
+
+	// lazy: no session for routes not using it
+	if w := c.get("/ping"); len(w.Result().Cookies()) != 0 || store.Len() != 0 {
+		t.Fatalf("unexpected session of untouched route")
+	}
+	if w := c.get("/api/me"); w.Code != 200 || store.Len() != 0 {
+		t.Fatalf("expecting sessions disabled by route metadata, got %d", w.Code)
+	}
+
+	c.get("/login")
+	first := c.cookies["session"]
+	if first == nil || store.Len() != 1 {
+		t.Fatalf("expecting session cookie, got %v", c.cookies)
+	}
+	if w := c.get("/me"); w.Body.String() != first.Value+" ann,welcome" {
+		t.Fatalf("unexpected session %q", w.Body.String())
+	}
+	if w := c.get("/me"); w.Body.String() != first.Value+" ann" {
+		t.Fatalf("expecting flashes consumed, got %q", w.Body.String())
+	}
+
+	// ID rotation on login deletes the old session
+	c.get("/login")
+	if c.cookies["session"].Value == first.Value || store.Len() != 1 {
+		t.Fatalf("expecting renewed session ID, got %v", c.cookies["session"])
+	}
+
+	c.get("/logout")
+	if c.cookies["session"] != nil || store.Len() != 0 {
+		t.Fatalf("expecting destroyed session, got %v", c.cookies)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Unix(1000, 0)
+	m := New(NewMemoryStore())
+	m.IdleTimeout = 10 * time.Minute
+	m.AbsoluteTimeout = time.Hour
+	m.now = func() time.Time { return now }
+	c := &client{h: newRouter(m), cookies: map[string]*http.Cookie{}}
+
+	c.get("/login")
+	id := c.cookies["session"].Value
+	if c.cookies["session"].MaxAge != 600 {
+		t.Fatalf("expecting idle timeout max age, got %d", c.cookies["session"].MaxAge)
+	}
+
+	// each use extends the idle timeout, up to the absolute timeout
+	for i := 0; i < 6; i++ {
+		now = now.Add(9 * time.Minute)
+		if w := c.get("/me"); !strings.HasPrefix(w.Body.String(), id+" ann") {
+			t.Fatalf("[%d] expecting session alive, got %q", i, w.Body.String())
+		}
+	}
+	if c.cookies["session"].MaxAge != 360 {
+		t.Fatalf("expecting absolute timeout max age, got %d", c.cookies["session"].MaxAge)
+	}
+	now = now.Add(9 * time.Minute)
+	if w := c.get("/me"); w.Code != 500 {
+		t.Fatalf("expecting expired session, got %q", w.Body.String())
+	}
+
+	c.get("/login")
+	now = now.Add(11 * time.Minute)
+	if w := c.get("/me"); w.Code != 500 {
+		t.Fatalf("expecting idle session expired, got %q", w.Body.String())
+	}
+}
+
+func TestStores(t *testing.T) {
+	signed, err := NewCookieStore([]byte("hash-key"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := NewCookieStore(nil, []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]Store{"signed": signed, "encrypted": encrypted, "file": files, "memory": NewMemoryStore()} {
+		s := newSession(time.Now())
+		s.Set("user", "ann")
+		value, err := store.Save(s, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		loaded, err := store.Load(value)
+		if err != nil || loaded == nil || loaded.ID != s.ID || loaded.Get("user") != "ann" {
+			t.Fatalf("%s: unexpected session %v %v", name, loaded, err)
+		}
+		if name == "encrypted" && strings.Contains(value, "ann") {
+			t.Fatalf("%s: session not encrypted", name)
+		}
+		if loaded, _ := store.Load(value[:len(value)-2] + "xx"); loaded != nil {
+			t.Fatalf("%s: expecting tampered value rejected", name)
+		}
+		if loaded, _ := store.Load("../../etc/passwd"); loaded != nil {
+			t.Fatalf("%s: expecting bad value rejected", name)
+		}
+		if err := store.Delete(s); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, ok := store.(*CookieStore); !ok {
+			if loaded, _ := store.Load(value); loaded != nil {
+				t.Fatalf("%s: expecting deleted session", name)
+			}
+		}
+	}
+}
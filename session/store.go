@@ -0,0 +1,267 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store loads and saves the sessions.
+type Store interface {
+	// Load returns the session of the cookie value, or nil if it doesn't
+	// exist or is invalid.
+	Load(value string) (*Session, error)
+
+	// Save saves the session, expiring in `ttl` if not zero, and returns the
+	// cookie value.
+	Save(s *Session, ttl time.Duration) (value string, err error)
+
+	// Delete deletes the session.
+	Delete(s *Session) error
+}
+
+// CookieStore stores the sessions in the cookie, signed with HMAC-SHA256, or
+// encrypted with AES-GCM.
+type CookieStore struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// NewCookieStore returns a new cookie store. If `blockKey` is not nil, the
+// sessions are encrypted with it, and it must be 16, 24 or 32 bytes long to
+// select AES-128, AES-192, or AES-256. Otherwise they are signed with
+// `hashKey`.
+func NewCookieStore(hashKey, blockKey []byte) (*CookieStore, error) {
+	cs := &CookieStore{hashKey: hashKey}
+	if blockKey != nil {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			return nil, err
+		}
+		if cs.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	} else if len(hashKey) == 0 {
+		return nil, errors.New("session: empty cookie hash key")
+	}
+	return cs, nil
+}
+
+func (cs *CookieStore) Load(value string) (*Session, error) {
+	var data []byte
+	if cs.aead != nil {
+		sealed, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(sealed) < cs.aead.NonceSize() {
+			return nil, nil
+		}
+		nonce := sealed[:cs.aead.NonceSize()]
+		if data, err = cs.aead.Open(nil, nonce, sealed[len(nonce):], nil); err != nil {
+			return nil, nil
+		}
+	} else {
+		pos := strings.LastIndexByte(value, '.')
+		if pos == -1 {
+			return nil, nil
+		}
+		sig, err := base64.RawURLEncoding.DecodeString(value[pos+1:])
+		if err != nil || !hmac.Equal(sig, cs.sign(value[:pos])) {
+			return nil, nil
+		}
+		if data, err = base64.RawURLEncoding.DecodeString(value[:pos]); err != nil {
+			return nil, nil
+		}
+	}
+	s := &Session{}
+	if json.Unmarshal(data, s) != nil {
+		return nil, nil
+	}
+	return s, nil
+}
+
+func (cs *CookieStore) Save(s *Session, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	if cs.aead != nil {
+		nonce := make([]byte, cs.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(cs.aead.Seal(nonce, nonce, data, nil)), nil
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(cs.sign(payload)), nil
+}
+
+// Delete does nothing: the cookie is expired by the manager.
+func (cs *CookieStore) Delete(s *Session) error {
+	return nil
+}
+
+func (cs *CookieStore) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, cs.hashKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// MemoryStore stores the sessions in memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	now      func() time.Time
+}
+
+// NewMemoryStore returns a new memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]memoryEntry{}, now: time.Now}
+}
+
+func (ms *MemoryStore) Load(id string) (*Session, error) {
+	ms.mu.Lock()
+	e, ok := ms.sessions[id]
+	if ok && !e.expires.IsZero() && !ms.now().Before(e.expires) {
+		delete(ms.sessions, id)
+		ok = false
+	}
+	ms.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	s := &Session{}
+	return s, json.Unmarshal(e.data, s)
+}
+
+func (ms *MemoryStore) Save(s *Session, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	e := memoryEntry{data: data}
+	if ttl > 0 {
+		e.expires = ms.now().Add(ttl)
+	}
+	ms.mu.Lock()
+	ms.sessions[s.ID] = e
+	ms.mu.Unlock()
+	return s.ID, nil
+}
+
+func (ms *MemoryStore) Delete(s *Session) error {
+	ms.mu.Lock()
+	delete(ms.sessions, s.ID)
+	ms.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of sessions, including the expired ones not yet
+// removed.
+func (ms *MemoryStore) Len() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.sessions)
+}
+
+var sessionIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FileStore stores the sessions as files of a directory, a JSON file per
+// session. Expired files are removed when loaded.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a new file store of the directory `dir`, creating it
+// if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+type fileEntry struct {
+	Session *Session  `json:"session"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (fs *FileStore) path(id string) string {
+	return filepath.Join(fs.Dir, id+".json")
+}
+
+func (fs *FileStore) Load(id string) (*Session, error) {
+	if !sessionIDRegexp.MatchString(id) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(fs.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var e fileEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if !e.Expires.IsZero() && !time.Now().Before(e.Expires) {
+		return nil, fs.Delete(e.Session)
+	}
+	return e.Session, nil
+}
+
+func (fs *FileStore) Save(s *Session, ttl time.Duration) (string, error) {
+	e := fileEntry{Session: s}
+	if ttl > 0 {
+		e.Expires = time.Now().Add(ttl)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	// write and rename, so concurrent loads never read a partial file
+	tmp, err := ioutil.TempFile(fs.Dir, ".session-")
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fs.path(s.ID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return s.ID, nil
+}
+
+func (fs *FileStore) Delete(s *Session) error {
+	if s == nil || !sessionIDRegexp.MatchString(s.ID) {
+		return nil
+	}
+	if err := os.Remove(fs.path(s.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
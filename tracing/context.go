@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/moisespsena-go/xroute/internal/traceparent"
+)
+
+// TraceID is a W3C trace id.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the id isn't zero.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID is a W3C span (parent) id.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the id isn't zero.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// FlagSampled is the sampled trace flag.
+const FlagSampled byte = 0x01
+
+// SpanContext is the propagated part of a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// State is the vendor specific `tracestate` header value.
+	State string
+}
+
+// IsValid reports whether the trace and span ids are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the `traceparent` header value.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a `traceparent` header value. Future versions are
+// accepted as long as they start with the version 00 fields.
+func ParseTraceparent(value string) (sc SpanContext, ok bool) {
+	traceID, spanID, flags, ok := traceparent.Parse(value)
+	if !ok {
+		return
+	}
+	return SpanContext{TraceID: traceID, SpanID: spanID, Flags: flags}, true
+}
+
+// Extract returns the span context propagated by the `traceparent` and
+// `tracestate` headers.
+func Extract(header http.Header) (sc SpanContext, ok bool) {
+	if sc, ok = ParseTraceparent(header.Get("traceparent")); ok {
+		sc.State = strings.Join(header["Tracestate"], ",")
+	}
+	return
+}
+
+// Inject sets the `traceparent` and `tracestate` headers of `sc`, for
+// outgoing requests.
+func Inject(sc SpanContext, header http.Header) {
+	header.Set("traceparent", sc.Traceparent())
+	if sc.State != "" {
+		header.Set("tracestate", sc.State)
+	} else {
+		header.Del("tracestate")
+	}
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return
+}
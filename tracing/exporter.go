@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Exporter exports the spans of a request.
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// MemoryExporter keeps the exported spans in memory. Useful for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewMemoryExporter returns a new in-memory exporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (e *MemoryExporter) Export(spans []*Span) error {
+	e.mu.Lock()
+	e.spans = append(e.spans, spans...)
+	e.mu.Unlock()
+	return nil
+}
+
+// Spans returns the exported spans, in start order per request.
+func (e *MemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset removes the exported spans.
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	e.spans = nil
+	e.mu.Unlock()
+}
+
+// OTLPJSONExporter writes the spans of each request as an OTLP-JSON
+// `ExportTraceServiceRequest`, one per line, as read by the OpenTelemetry
+// collector file receiver.
+type OTLPJSONExporter struct {
+	ServiceName string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewOTLPJSONExporter returns a new OTLP-JSON exporter writing to `w`.
+func NewOTLPJSONExporter(serviceName string, w io.Writer) *OTLPJSONExporter {
+	return &OTLPJSONExporter{ServiceName: serviceName, w: w}
+}
+
+// NewFileExporter returns a new OTLP-JSON exporter appending to the file
+// `path`. The file is closed by Close.
+func NewFileExporter(serviceName, path string) (*OTLPJSONExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewOTLPJSONExporter(serviceName, f), nil
+}
+
+func (e *OTLPJSONExporter) Export(spans []*Span) error {
+	var req otlpRequest
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/moisespsena-go/xroute/tracing"}}}}
+	if e.ServiceName != "" {
+		rs.Resource.Attributes = []otlpAttribute{{"service.name", otlpValue{e.ServiceName}}}
+	}
+	for _, s := range spans {
+		rs.ScopeSpans[0].Spans = append(rs.ScopeSpans[0].Spans, newOTLPSpan(s))
+	}
+	req.ResourceSpans = []otlpResourceSpans{rs}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Close closes the writer, if it is an io.Closer.
+func (e *OTLPJSONExporter) Close() error {
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes,omitempty"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	TraceState        string          `json:"traceState,omitempty"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func newOTLPSpan(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := otlpSpan{
+		TraceID:           s.Context.TraceID.String(),
+		SpanID:            s.Context.SpanID.String(),
+		TraceState:        s.Context.State,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            otlpStatus{s.Status, s.StatusMsg},
+	}
+	if s.Parent.IsValid() {
+		out.ParentSpanID = s.Parent.String()
+	}
+	for _, a := range s.Attributes {
+		out.Attributes = append(out.Attributes, otlpAttribute{a.Key, otlpValue{a.Value}})
+	}
+	return out
+}
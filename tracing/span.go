@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+)
+
+// SpanKind is the span kind.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// StatusCode is the span status code.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a span attribute.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Span is a timed operation of a request.
+type Span struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Status     StatusCode
+	StatusMsg  string
+
+	mu    sync.Mutex
+	trace *trace
+	ended bool
+}
+
+// SetAttribute sets the attribute `key`.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, a := range s.Attributes {
+		if a.Key == key {
+			s.Attributes[i].Value = value
+			return
+		}
+	}
+	s.Attributes = append(s.Attributes, Attribute{key, value})
+}
+
+// Attribute returns the value of the attribute `key`.
+func (s *Span) Attribute(key string) (value string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return
+}
+
+// SetStatus sets the span status.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	s.mu.Lock()
+	s.Status, s.StatusMsg = code, msg
+	s.mu.Unlock()
+}
+
+// Finish ends the span. Calling it more than once has no effect.
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = s.trace.tracer.now()
+	s.mu.Unlock()
+	s.trace.pop(s)
+}
+
+// Duration returns the span duration.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
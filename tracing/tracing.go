@@ -0,0 +1,216 @@
+// Package tracing records a span per router, per named middleware and for
+// the endpoint of each request, propagating the W3C `traceparent` and
+// `tracestate` headers.
+//
+//	exporter, err := tracing.NewFileExporter("my-service", "traces.jsonl")
+//	...
+//	tracer := tracing.New(exporter)
+//	r.Use(tracer.Middleware())
+//
+// Outbound calls made with Transport are recorded as client spans, and
+// propagate their trace context:
+//
+//	client := &http.Client{Transport: &tracing.Transport{}}
+//	req, _ := http.NewRequestWithContext(r.Context(), "GET", "http://api/items", nil)
+//	res, err := client.Do(req)
+//
+// Spans are exported when the request ends.
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the tracing middleware.
+const Name = "tracing"
+
+type traceKey struct{}
+
+// Tracer opens the request spans and exports them.
+type Tracer struct {
+	Exporter Exporter
+
+	now func() time.Time
+}
+
+// New returns a new tracer.
+func New(exporter Exporter) *Tracer {
+	return &Tracer{Exporter: exporter, now: time.Now}
+}
+
+// Middleware returns the named tracing middleware. It should be the first
+// middleware of the root router.
+func (t *Tracer) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: t.Handler}
+}
+
+// Handler is the tracing middleware handler.
+func (t *Tracer) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+
+	tr := &trace{tracer: t}
+	parent, _ := Extract(r.Header)
+	root := tr.start(r.Method, KindServer, parent)
+	root.SetAttribute("http.method", r.Method)
+	root.SetAttribute("http.target", r.URL.RequestURI())
+	if router := rctx.Router(); router != nil {
+		root.SetAttribute("xroute.router", routerName(router))
+	}
+
+	rctx.Data[traceKey{}] = tr
+	rctx.Observe(tr)
+
+	defer func() {
+		status := chain.Writer.Status()
+		if status == 0 {
+			status = 200
+		}
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			root.Name = r.Method + " " + pattern
+		}
+		tagRoute(root, rctx)
+		root.SetAttribute("http.status_code", strconv.Itoa(status))
+		if status >= 500 {
+			root.SetStatus(StatusError, http.StatusText(status))
+		}
+		root.Finish()
+
+		if t.Exporter != nil {
+			if err := t.Exporter.Export(tr.spans); err != nil && rctx.Log != nil {
+				rctx.Log.Errorf("tracing: export failed: %v", err)
+			}
+		}
+	}()
+
+	chain.Next()
+}
+
+// CurrentSpan returns the innermost open span of the request, or nil if the
+// request isn't traced.
+func CurrentSpan(rctx *xroute.RouteContext) *Span {
+	if rctx == nil {
+		return nil
+	}
+	if tr, ok := rctx.Data[traceKey{}].(*trace); ok {
+		return tr.current()
+	}
+	return nil
+}
+
+// SpanFromRequest returns the innermost open span of the request, or nil if
+// the request isn't traced.
+func SpanFromRequest(r *http.Request) *Span {
+	return CurrentSpan(xroute.RouteContextFromRequest(r))
+}
+
+// StartSpan opens a child span of the current span. The span must be
+// finished by the caller. Returns nil if the request isn't traced.
+func StartSpan(rctx *xroute.RouteContext, name string) *Span {
+	if rctx == nil {
+		return nil
+	}
+	if tr, ok := rctx.Data[traceKey{}].(*trace); ok {
+		return tr.start(name, KindInternal, SpanContext{})
+	}
+	return nil
+}
+
+// trace holds the spans of a request. Open spans are a stack: new spans are
+// children of the innermost open span.
+type trace struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	stack []*Span
+	spans []*Span
+}
+
+func (tr *trace) start(name string, kind SpanKind, remote SpanContext) *Span {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	s := &Span{Name: name, Kind: kind, Start: tr.tracer.now(), trace: tr}
+	s.Context.SpanID = newSpanID()
+
+	if n := len(tr.stack); n > 0 {
+		parent := tr.stack[n-1].Context
+		s.Context.TraceID, s.Context.Flags, s.Context.State = parent.TraceID, parent.Flags, parent.State
+		s.Parent = parent.SpanID
+	} else if remote.IsValid() {
+		s.Context.TraceID, s.Context.Flags, s.Context.State = remote.TraceID, remote.Flags, remote.State
+		s.Parent = remote.SpanID
+	} else {
+		s.Context.TraceID = newTraceID()
+		s.Context.Flags = FlagSampled
+	}
+
+	tr.stack = append(tr.stack, s)
+	tr.spans = append(tr.spans, s)
+	return s
+}
+
+func (tr *trace) pop(s *Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for i := len(tr.stack) - 1; i >= 0; i-- {
+		if tr.stack[i] == s {
+			tr.stack = append(tr.stack[:i], tr.stack[i+1:]...)
+			return
+		}
+	}
+}
+
+func (tr *trace) current() *Span {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if n := len(tr.stack); n > 0 {
+		return tr.stack[n-1]
+	}
+	return nil
+}
+
+// Begin implements xroute.Observer.
+func (tr *trace) Begin(step *xroute.Step) func() {
+	var s *Span
+	switch step.Kind {
+	case xroute.StepRouter:
+		name := routerName(step.Router)
+		s = tr.start("router "+name, KindInternal, SpanContext{})
+		s.SetAttribute("xroute.router", name)
+	case xroute.StepMiddleware:
+		if step.Middleware.Name == "" {
+			return nil
+		}
+		s = tr.start("middleware "+step.Middleware.Name, KindInternal, SpanContext{})
+		s.SetAttribute("xroute.middleware", step.Middleware.Name)
+	default:
+		s = tr.start("endpoint "+step.Context.RoutePattern(), KindInternal, SpanContext{})
+	}
+	return func() {
+		tagRoute(s, step.Context)
+		s.Finish()
+	}
+}
+
+func routerName(router xroute.Router) string {
+	if prefix := router.Prefix(); prefix != "" {
+		return prefix
+	}
+	return "/"
+}
+
+func tagRoute(s *Span, rctx *xroute.RouteContext) {
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		s.SetAttribute("http.route", pattern)
+	}
+	for _, v := range rctx.URLParams.Values {
+		if v.Key != nil && *v.Key != "*" {
+			s.SetAttribute("xroute.param."+*v.Key, *v.Value)
+		}
+	}
+}
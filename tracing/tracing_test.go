@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || sc.Flags != FlagSampled {
+		t.Fatalf("unexpected span context %+v %v", sc, ok)
+	}
+	if sc.Traceparent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("unexpected traceparent %q", sc.Traceparent())
+	}
+	if _, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Fatal("future versions must be accepted")
+	}
+	for _, v := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, ok = ParseTraceparent(v); ok {
+			t.Fatalf("%q must be invalid", v)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := NewMemoryExporter()
+	var otlp bytes.Buffer
+	tracer := New(exporters{exporter, NewOTLPJSONExporter("test", &otlp)})
+
+	api := xroute.NewRouter()
+	api.Use(&xroute.Middleware{Name: "auth", Handler: func(chain *xroute.ChainHandler) {
+		chain.Next()
+	}})
+	api.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s := StartSpan(xroute.RouteContextFromRequest(r), "load user")
+		s.Finish()
+		w.Write([]byte("user"))
+	})
+
+	r := xroute.NewRouter()
+	r.Use(tracer.Middleware())
+	r.Use(func(chain *xroute.ChainHandler) {
+		chain.Next()
+	})
+	r.Mount("/api", api)
+	r.With(&xroute.Middleware{Name: "inline", Handler: func(chain *xroute.ChainHandler) {
+		chain.Next()
+	}}).Get("/ping", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/api/users/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=value")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	spans := exporter.Spans()
+	names := []string{
+		"GET /api/users/{id}",
+		"router /api",
+		"middleware auth",
+		"endpoint /api/users/{id}",
+		"load user",
+	}
+	if len(spans) != len(names) {
+		for _, s := range spans {
+			t.Log(s.Name)
+		}
+		t.Fatalf("expected %d spans, got %d", len(names), len(spans))
+	}
+	for i, s := range spans {
+		if s.Name != names[i] {
+			t.Fatalf("span %d: expected %q, got %q", i, names[i], s.Name)
+		}
+		if s.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Context.State != "vendor=value" {
+			t.Fatalf("span %q: trace context not propagated: %+v", s.Name, s.Context)
+		}
+		if i == 0 {
+			if s.Parent.String() != "00f067aa0ba902b7" || s.Kind != KindServer {
+				t.Fatalf("unexpected root span %+v", s)
+			}
+		} else if s.Parent != spans[i-1].Context.SpanID {
+			t.Fatalf("span %q: unexpected parent", s.Name)
+		}
+		if v, _ := s.Attribute("http.route"); v != "/api/users/{id}" && s.Name != "load user" {
+			t.Fatalf("span %q: unexpected route %q", s.Name, v)
+		}
+		if s.End.Before(s.Start) {
+			t.Fatalf("span %q not finished", s.Name)
+		}
+	}
+	if v, _ := spans[3].Attribute("xroute.param.id"); v != "7" {
+		t.Fatalf("unexpected param %q", v)
+	}
+	if v, _ := spans[0].Attribute("http.status_code"); v != "200" {
+		t.Fatalf("unexpected status %q", v)
+	}
+
+	var exported otlpRequest
+	if err := json.Unmarshal(otlp.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	rs := exported.ResourceSpans[0]
+	if rs.Resource.Attributes[0].Value.StringValue != "test" || len(rs.ScopeSpans[0].Spans) != len(names) {
+		t.Fatalf("unexpected OTLP export %s", otlp.String())
+	}
+	if s := rs.ScopeSpans[0].Spans[1]; s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != spans[0].Context.SpanID.String() || s.Kind != KindInternal {
+		t.Fatalf("unexpected OTLP span %+v", s)
+	}
+
+	exporter.Reset()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ping", nil))
+	names = []string{"GET /ping", "middleware inline", "endpoint /ping"}
+	spans = exporter.Spans()
+	if len(spans) != len(names) {
+		t.Fatalf("expected %d spans, got %d", len(names), len(spans))
+	}
+	for i, s := range spans {
+		if s.Name != names[i] {
+			t.Fatalf("span %d: expected %q, got %q", i, names[i], s.Name)
+		}
+		if s.Context.TraceID != spans[0].Context.TraceID {
+			t.Fatalf("span %q: unexpected trace id", s.Name)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("traceparent") + " " + r.Header.Get("tracestate")))
+	}))
+	defer upstream.Close()
+
+	exporter := NewMemoryExporter()
+	client := &http.Client{Transport: &Transport{}}
+	r := xroute.NewRouter()
+	r.Use(New(exporter).Middleware())
+	r.Get("/proxy", func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL+"/items", nil)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer res.Body.Close()
+		io.Copy(w, res.Body)
+	})
+
+	req := httptest.NewRequest("GET", "/proxy", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=value")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	spans := exporter.Spans()
+	var cs, endpoint *Span
+	for _, s := range spans {
+		switch s.Name {
+		case "HTTP GET":
+			cs = s
+		case "endpoint /proxy":
+			endpoint = s
+		}
+	}
+	if cs == nil || endpoint == nil {
+		t.Fatalf("expected client and endpoint spans, got %d spans", len(spans))
+	}
+	if cs.Kind != KindClient || cs.Parent != endpoint.Context.SpanID || cs.End.Before(cs.Start) {
+		t.Fatalf("unexpected client span %+v", cs)
+	}
+	if v, _ := cs.Attribute("http.status_code"); v != "200" {
+		t.Fatalf("unexpected status %q", v)
+	}
+	if expected := cs.Context.Traceparent() + " vendor=value"; w.Body.String() != expected {
+		t.Fatalf("expected propagated %q, got %q", expected, w.Body.String())
+	}
+	if cs.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected trace id %s", cs.Context.TraceID)
+	}
+
+	// untraced requests are sent as is
+	req, _ = http.NewRequest("GET", upstream.URL, nil)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != " " {
+		t.Fatalf("expected no trace context, got %q", body)
+	}
+}
+
+type exporters []Exporter
+
+func (e exporters) Export(spans []*Span) error {
+	for _, exp := range e {
+		if err := exp.Export(spans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
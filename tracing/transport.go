@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Transport is a http.RoundTripper that records the outbound requests as
+// client spans of the request of their context, and injects the span
+// context in their `traceparent` and `tracestate` headers. Requests of
+// untraced contexts are sent as is. It can wrap xroute.RequestIDTransport:
+//
+//	client := &http.Client{Transport: &tracing.Transport{Base: &xroute.RequestIDTransport{}}}
+type Transport struct {
+	// Base is the underlying round tripper. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	s := StartSpan(xroute.RouteContextFromRequest(req), "HTTP "+req.Method)
+	if s == nil {
+		return base.RoundTrip(req)
+	}
+	defer s.Finish()
+	s.Kind = KindClient
+	s.SetAttribute("http.method", req.Method)
+	s.SetAttribute("http.url", req.URL.Redacted())
+
+	req = req.Clone(req.Context())
+	Inject(s.Context, req.Header)
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+		return nil, err
+	}
+	s.SetAttribute("http.status_code", strconv.Itoa(res.StatusCode))
+	if res.StatusCode >= 500 {
+		s.SetStatus(StatusError, http.StatusText(res.StatusCode))
+	}
+	return res, nil
+}
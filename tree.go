@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
-	"reflect"
+	"net/url"
 	"regexp"
 	"sort"
 	"strconv"
@@ -110,8 +110,12 @@ type node struct {
 	suffix string
 }
 
-type endpointHeadersHandler struct {
-	headers http.Header
+type endpointVariant struct {
+	// request constraints of the handler
+	constraints Constraints
+
+	// metadata of the handler
+	meta Meta
 
 	// endpoint handler
 	handler ContextHandler
@@ -131,21 +135,21 @@ type endpoint struct {
 	// parameter keys recorded on handler nodes
 	paramKeys []string
 
-	// handlers
-	handlers []*endpointHeadersHandler
+	// handlers by constraints, in registration order
+	handlers []*endpointVariant
 }
 
-func (ep *endpoint) add(override bool, headers http.Header, handler ContextHandler) {
-	if h := ep.find(headers); h != nil {
-		if reflect.DeepEqual(headers, h.headers) {
+func (ep *endpoint) add(override bool, constraints Constraints, meta Meta, handler ContextHandler) {
+	for _, v := range ep.handlers {
+		if v.constraints.Equal(constraints) {
 			if override {
-				h.handler = handler
+				v.meta, v.handler = meta, handler
 				return
 			}
 			panic(ErrDuplicateHandler)
 		}
 	}
-	ep.handlers = append(ep.handlers, &endpointHeadersHandler{headers, handler})
+	ep.handlers = append(ep.handlers, &endpointVariant{constraints, meta, handler})
 	if ep.handler == nil {
 		ep.handler = &EndpointHandler{ep}
 	}
@@ -155,9 +159,11 @@ func (ep *endpoint) HasHandler() bool {
 	return len(ep.handlers) > 0
 }
 
+// Handler returns the endpoint handler, or the handler matching a request
+// with the `headers`.
 func (ep *endpoint) Handler(headers ...http.Header) ContextHandler {
 	if len(headers) > 0 {
-		if h := ep.find(headers[0]); h != nil {
+		if h := ep.find(&http.Request{Header: headers[0], URL: &url.URL{}}, NewRouteContext()); h != nil {
 			return h.handler
 		}
 		return nil
@@ -165,36 +171,16 @@ func (ep *endpoint) Handler(headers ...http.Header) ContextHandler {
 	return ep.handler
 }
 
-func (ep *endpoint) find(headers http.Header) *endpointHeadersHandler {
-	var match []*endpointHeadersHandler
-
-main:
-	for _, ehh := range ep.handlers {
-		if ehh.headers != nil {
-			for hn, hvs := range ehh.headers {
-				var ok bool
-				for _, hv := range hvs {
-					if headers.Get(hn) == hv {
-						ok = true
-						break
-					}
-				}
-				if !ok {
-					continue main
-				}
-			}
+// find returns the most specific handler whose constraints match the
+// request, or nil.
+func (ep *endpoint) find(r *http.Request, rctx *RouteContext) *endpointVariant {
+	var match *endpointVariant
+	for _, v := range ep.handlers {
+		if v.constraints.Match(r, rctx) && (match == nil || v.constraints.moreSpecific(match.constraints)) {
+			match = v
 		}
-		match = append(match, ehh)
 	}
-
-	if match != nil {
-		sort.Slice(match, func(i, j int) bool {
-			return len(match[i].headers) > len(match[j].headers)
-		})
-		return match[0]
-	}
-
-	return nil
+	return match
 }
 
 func (s endpoints) Value(method MethodType) *endpoint {
@@ -263,22 +249,38 @@ func (n *node) GetRoute(method MethodType, pattern string) *EndpointHandler {
 	}
 }
 
-func (n *node) InsertRoute(override bool, method MethodType, pattern string, handler ContextHandler, headers ...http.Header) *node {
-	if len(headers) == 0 {
-		headers = []http.Header{nil}
+func (n *node) InsertRoute(override bool, method MethodType, pattern string, handler ContextHandler, constraints ...Constraints) *node {
+	if len(constraints) == 0 {
+		constraints = []Constraints{{}}
+	}
+	return n.InsertRouteCb(override, method, pattern, constraints[0], nil, handler, func(n *node) {})
+}
+
+func (n *node) InsertRouteCb(override bool, method MethodType, pattern string, constraints Constraints, meta Meta, handler ContextHandler, cb func(n *node)) *node {
+	variants := patOptionalVariants(pattern)
+	if variants == nil {
+		return n.insertRoute(override, method, pattern, pattern, constraints, meta, handler, cb)
 	}
-	return n.InsertRouteCb(override, method, pattern, headers[0], handler, func(n *node) {})
+
+	// insert a route per optional variant, all of them reporting the
+	// pattern as given
+	hn := n.insertRoute(override, method, pattern, variants[0], constraints, meta, handler, cb)
+	for _, variant := range variants[1:] {
+		n.insertRoute(override, method, pattern, variant, constraints, meta, handler, cb)
+	}
+	return hn
 }
 
-func (n *node) InsertRouteCb(override bool, method MethodType, pattern string, headers http.Header, handler ContextHandler, cb func(n *node)) *node {
+// insertRoute inserts the route `search` with the endpoint pattern `pattern`.
+func (n *node) insertRoute(override bool, method MethodType, pattern, search string, constraints Constraints, meta Meta, handler ContextHandler, cb func(n *node)) *node {
 	var parent *node
-	search := pattern
+	paramKeys := patParamKeys(search)
 
 	for {
 		// Handle key exhaustion
 		if len(search) == 0 {
 			// Insert or update the node's leaf handler
-			n.setEndpoint(override, method, headers, handler, pattern)
+			n.setEndpoint(override, method, constraints, meta, handler, pattern, paramKeys)
 			return n
 		}
 
@@ -307,7 +309,7 @@ func (n *node) InsertRouteCb(override bool, method MethodType, pattern string, h
 			child := &node{label: label, tail: segTail, prefix: search}
 			hn := parent.addChildCb(child, search, cb)
 
-			hn.setEndpoint(override, method, headers, handler, pattern)
+			hn.setEndpoint(override, method, constraints, meta, handler, pattern, paramKeys)
 			return hn
 		}
 
@@ -346,7 +348,7 @@ func (n *node) InsertRouteCb(override bool, method MethodType, pattern string, h
 		// If the new key is a subset, set the method/handler on this node and finish.
 		search = search[commonPrefix:]
 		if len(search) == 0 {
-			child.setEndpoint(override, method, headers, handler, pattern)
+			child.setEndpoint(override, method, constraints, meta, handler, pattern, paramKeys)
 			return child
 		}
 
@@ -357,7 +359,7 @@ func (n *node) InsertRouteCb(override bool, method MethodType, pattern string, h
 			prefix: search,
 		}
 		hn := child.addChildCb(subchild, search, cb)
-		hn.setEndpoint(override, method, headers, handler, pattern)
+		hn.setEndpoint(override, method, constraints, meta, handler, pattern, paramKeys)
 		return hn
 	}
 }
@@ -403,9 +405,10 @@ func (n *node) addChildCb(child *node, prefix string, cb func(n *node)) *node {
 			// Route starts with a param
 			child.typ = segTyp
 
-			if segTyp == ntCatchAll {
+			if segTyp == ntCatchAll && search[0] == '*' {
 				segStartIdx = -1
 			} else {
+				// params and named catch-alls may have a static suffix
 				segStartIdx = segEndIdx
 			}
 			if segStartIdx < 0 {
@@ -467,6 +470,14 @@ func (n *node) replaceChild(label, tail byte, child *node) {
 
 func (n *node) getEdge(ntyp nodeTyp, label, tail byte, prefix string) *node {
 	nds := n.children[ntyp]
+	if ntyp == ntCatchAll {
+		// a single catch-all node holds the anonymous and named catch-alls
+		// and their suffixes
+		if len(nds) > 0 {
+			return nds[0]
+		}
+		return nil
+	}
 	for i := 0; i < len(nds); i++ {
 		if nds[i].label == label && nds[i].tail == tail {
 			if ntyp == ntRegexp && nds[i].prefix != prefix {
@@ -478,22 +489,20 @@ func (n *node) getEdge(ntyp nodeTyp, label, tail byte, prefix string) *node {
 	return nil
 }
 
-func (n *node) setEndpoint(override bool, method MethodType, headers http.Header, handler ContextHandler, pattern string) {
+func (n *node) setEndpoint(override bool, method MethodType, constraints Constraints, meta Meta, handler ContextHandler, pattern string, paramKeys []string) {
 	// Set the handler for the method type on the node
 	if n.endpoints == nil {
 		n.endpoints = make(endpoints, 0)
 	}
 
-	paramKeys := patParamKeys(pattern)
-
 	if method&STUB == STUB {
-		n.endpoints.Value(STUB).add(override, headers, handler)
+		n.endpoints.Value(STUB).add(override, constraints, meta, handler)
 	}
 
 	set := func(h *endpoint) {
 		h.pattern = pattern
 		h.paramKeys = paramKeys
-		h.add(override, headers, handler)
+		h.add(override, constraints, meta, handler)
 	}
 
 	if method&ALL == ALL {
@@ -568,21 +577,21 @@ func (n *node) findRoute(rctx *RouteContext, method MethodType, path string) *no
 
 			// serially loop through each node grouped by the tail delimiter
 			for idx := 0; idx < len(nds); idx++ {
-				xn = nds[idx]
+				cn := nds[idx]
 
 				// label for param nodes is the delimiter byte
-				p := strings.IndexByte(xsearch, xn.tail)
+				p := strings.IndexByte(xsearch, cn.tail)
 
 				if p <= 0 {
-					if xn.tail == '/' {
+					if cn.tail == '/' {
 						p = len(xsearch)
 					} else {
 						continue
 					}
 				}
 
-				if ntyp == ntRegexp && xn.rex != nil {
-					if xn.rex.Match([]byte(xsearch[:p])) == false {
+				if ntyp == ntRegexp && cn.rex != nil {
+					if cn.rex.Match([]byte(xsearch[:p])) == false {
 						continue
 					}
 				} else if strings.IndexByte(xsearch[:p], '/') != -1 {
@@ -596,14 +605,16 @@ func (n *node) findRoute(rctx *RouteContext, method MethodType, path string) *no
 				}
 				rctx.routeParams.Values = append(rctx.routeParams.Values, strings.TrimSuffix(value, ".json"))
 				xsearch = xsearch[p:]
+				xn = cn
 				break
 			}
 
 		default:
 			// catch-all nodes
-			rctx.routeParams.Values = append(rctx.routeParams.Values, search)
-			xn = nds[0]
-			xsearch = ""
+			if fin := nds[0].findCatchAll(rctx, method, search); fin != nil {
+				return fin
+			}
+			continue
 		}
 
 		if xn == nil {
@@ -643,6 +654,38 @@ func (n *node) findRoute(rctx *RouteContext, method MethodType, path string) *no
 	return nil
 }
 
+// findCatchAll matches the catch-all node `n` against `search`. Static
+// suffixes, such as /raw in /files/{path...}/raw, are tried first, taking the
+// longest catch-all value, then the catch-all takes the whole search.
+func (n *node) findCatchAll(rctx *RouteContext, method MethodType, search string) *node {
+	if nds := n.children[ntStatic]; len(nds) > 0 {
+		for p := len(search) - 1; p > 0; p-- {
+			if nds.findEdge(search[p]) == nil {
+				continue
+			}
+			rctx.routeParams.Values = append(rctx.routeParams.Values, search[:p])
+			if fin := n.findRoute(rctx, method, search[p:]); fin != nil {
+				return fin
+			}
+			rctx.routeParams.Values = rctx.routeParams.Values[:len(rctx.routeParams.Values)-1]
+		}
+	}
+
+	if n.isLeaf() {
+		h, _ := n.endpoints[method]
+		if h != nil && h.handler != nil {
+			rctx.routeParams.Values = append(rctx.routeParams.Values, search)
+			rctx.routeParams.Keys = append(rctx.routeParams.Keys, h.paramKeys...)
+			return n
+		}
+
+		// flag that the routing context found a route, but not a corresponding
+		// supported method
+		rctx.methodNotAllowed = true
+	}
+	return nil
+}
+
 func (n *node) findEdge(ntyp nodeTyp, label byte) *node {
 	nds := n.children[ntyp]
 	num := len(nds)
@@ -710,7 +753,11 @@ func (n *node) findPattern(pattern string) bool {
 			idx = strings.IndexByte(pattern, '}') + 1
 
 		case ntCatchAll:
-			idx = longestPrefix(pattern, "*")
+			if pattern[0] == '{' {
+				idx = strings.IndexByte(pattern, '}') + 1
+			} else {
+				idx = longestPrefix(pattern, "*")
+			}
 
 		default:
 			panic("chi: unknown node type")
@@ -729,6 +776,9 @@ func (n *node) findPattern(pattern string) bool {
 func (n *node) routes() []Route {
 	rts := []Route{}
 
+	// patterns with optional segments are on a node per variant
+	seen := map[string]bool{}
+
 	n.walk(func(eps endpoints, subroutes Routes) bool {
 		if eps[STUB] != nil && eps[STUB].handler != nil && subroutes == nil {
 			return false
@@ -750,9 +800,24 @@ func (n *node) routes() []Route {
 		}
 
 		for p, mh := range pats {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
 			hs := make(map[string]ContextHandler, 0)
+			var meta map[string]Meta
+			setMeta := func(m string, h *endpoint) {
+				if len(h.handlers) > 0 && len(h.handlers[0].meta) > 0 {
+					if meta == nil {
+						meta = map[string]Meta{}
+					}
+					meta[m] = h.handlers[0].meta
+				}
+			}
 			if mh[ALL] != nil && mh[ALL].handler != nil {
 				hs["*"] = mh[ALL].handler
+				setMeta("*", mh[ALL])
 			}
 
 			for mt, h := range mh {
@@ -764,9 +829,10 @@ func (n *node) routes() []Route {
 					continue
 				}
 				hs[m] = h.handler
+				setMeta(m, h)
 			}
 
-			rt := Route{p, hs, subroutes}
+			rt := Route{p, hs, subroutes, meta}
 			rts = append(rts, rt)
 		}
 
@@ -846,6 +912,18 @@ func patNextSegment(pattern string) (nodeTyp, string, string, byte, int, int) {
 			key = key[:idx]
 		}
 
+		// optional segment, expanded by InsertRoute
+		key = strings.TrimSuffix(key, "?")
+
+		// named catch-all: {path...} or {path:*}
+		if rexpat == "*" || (nt == ntParam && strings.HasSuffix(key, "...")) {
+			key = strings.TrimSuffix(key, "...")
+			if pe < len(pattern) && (pattern[pe] == '{' || pattern[pe] == '*') {
+				panic(fmt.Sprintf("chi: catch-all '%s' must be followed by a static segment", pattern[ps:pe]))
+			}
+			return ntCatchAll, key, "", tail, ps, pe
+		}
+
 		if len(rexpat) > 0 {
 			if rexpat[0] != '^' {
 				rexpat = "^" + rexpat
@@ -863,6 +941,81 @@ func patNextSegment(pattern string) (nodeTyp, string, string, byte, int, int) {
 	return ntCatchAll, "*", "", 0, ws, len(pattern)
 }
 
+// patSegmentOptional reports whether the param segment `seg`, including the
+// braces, is optional: {id?} or {id?:regexp}.
+func patSegmentOptional(seg string) bool {
+	key := seg[1 : len(seg)-1]
+	if idx := strings.Index(key, ":"); idx >= 0 {
+		key = key[:idx]
+	}
+	return strings.HasSuffix(key, "?")
+}
+
+// patOptionalVariants returns the patterns matched by a pattern with
+// optional segments, from the longest to the shortest, or nil if it has none.
+// Only the ending segments may be optional, optionally followed by a static
+// suffix without slashes:
+//
+//	/users/{id?}/{tab?}.json -> /users/{id}/{tab}.json, /users/{id}.json, /users.json
+func patOptionalVariants(pattern string) []string {
+	type segment struct{ start, end int }
+	var (
+		optionals []segment
+		pat       = pattern
+		offset    int
+	)
+	for {
+		ptyp, _, _, _, s, e := patNextSegment(pat)
+		if ptyp == ntStatic {
+			break
+		}
+		s, e = offset+s, offset+e
+		if ptyp != ntCatchAll || pattern[s] == '{' {
+			if patSegmentOptional(pattern[s:e]) {
+				if pattern[s-1] != '/' || (len(optionals) > 0 && pattern[optionals[len(optionals)-1].end:s] != "/") {
+					panic(fmt.Sprintf("chi: optional param '%s' must be a whole path segment", pattern[s:e]))
+				}
+				optionals = append(optionals, segment{s, e})
+			} else if len(optionals) > 0 {
+				panic(fmt.Sprintf("chi: routing pattern '%s' has a required param after an optional one", pattern))
+			}
+		}
+		pat, offset = pattern[e:], e
+	}
+	if len(optionals) == 0 {
+		return nil
+	}
+
+	last := optionals[len(optionals)-1]
+	if strings.IndexByte(pattern[last.end:], '/') >= 0 {
+		panic(fmt.Sprintf("chi: routing pattern '%s' has a static segment after an optional param", pattern))
+	}
+
+	// the required form, without the optional marks
+	var full strings.Builder
+	prev := 0
+	for _, seg := range optionals {
+		key := pattern[seg.start+1 : seg.end-1]
+		full.WriteString(pattern[prev:seg.start])
+		full.WriteString("{" + strings.Replace(key, "?", "", 1) + "}")
+		prev = seg.end
+	}
+	full.WriteString(pattern[prev:])
+
+	// drop the optional segments from the last one, keeping the suffix. Each
+	// optional mark removed moves the following segments a byte back.
+	variants := []string{full.String()}
+	suffix := pattern[last.end:]
+	for i := len(optionals) - 1; i >= 0; i-- {
+		v := variants[0][:optionals[i].start-1-i] + suffix
+		if v == "" || v[0] != '/' {
+			v = "/" + v
+		}
+		variants = append(variants, v)
+	}
+	return variants
+}
+
 func patParamKeys(pattern string) []string {
 	pat := pattern
 	paramKeys := []string{}
@@ -881,6 +1034,70 @@ func patParamKeys(pattern string) []string {
 	}
 }
 
+// BuildPath returns the path of the routing `pattern` with the `params`
+// values, the reverse of routing. Param values are path escaped and checked
+// against their regexps. Catch-all values may have many segments; the
+// anonymous catch-all value is the "*" param. Missing optional params are
+// omitted with their leading slash.
+//
+//	BuildPath("/files/{path...}/raw", map[string]string{"path": "a/b.txt"}) // "/files/a/b.txt/raw"
+func BuildPath(pattern string, params map[string]string) (string, error) {
+	var (
+		b       strings.Builder
+		pat     = pattern
+		omitted string
+	)
+	for {
+		ptyp, key, rexpat, _, s, e := patNextSegment(pat)
+		if ptyp == ntStatic {
+			b.WriteString(pat)
+			break
+		}
+		b.WriteString(pat[:s])
+		seg := pat[s:e]
+		value := params[key]
+
+		switch {
+		case ptyp == ntCatchAll:
+			parts := strings.Split(value, "/")
+			for i := range parts {
+				parts[i] = url.PathEscape(parts[i])
+			}
+			b.WriteString(strings.Join(parts, "/"))
+
+		case value == "":
+			if !patSegmentOptional(seg) {
+				return "", fmt.Errorf("xroute: route %q: param %q is missing", pattern, key)
+			}
+			path := strings.TrimSuffix(b.String(), "/")
+			b.Reset()
+			b.WriteString(path)
+			omitted = key
+
+		case omitted != "":
+			return "", fmt.Errorf("xroute: route %q: param %q is set but optional param %q before it is missing", pattern, key, omitted)
+
+		default:
+			if rexpat != "" {
+				rex, err := regexp.Compile(rexpat)
+				if err != nil {
+					return "", fmt.Errorf("xroute: route %q: invalid regexp pattern %q of param %q", pattern, rexpat, key)
+				}
+				if !rex.MatchString(value) {
+					return "", fmt.Errorf("xroute: route %q: value %q of param %q doesn't match %q", pattern, value, key, rexpat)
+				}
+			}
+			b.WriteString(url.PathEscape(value))
+		}
+		pat = pat[e:]
+	}
+
+	if b.Len() == 0 {
+		return "/", nil
+	}
+	return b.String(), nil
+}
+
 // longestPrefix finds the length of the shared prefix
 // of two strings
 func longestPrefix(k1, k2 string) int {
@@ -950,6 +1167,10 @@ type Route struct {
 	Pattern   string
 	Handlers  map[string]ContextHandler
 	SubRoutes Routes
+
+	// Meta is the metadata of the handlers, by method like Handlers, for the
+	// first handler of each endpoint (see EndpointHandler.Variants).
+	Meta map[string]Meta
 }
 
 // WalkFunc is the type of the function called for each method and route visited by Walk.
@@ -957,17 +1178,53 @@ type WalkFunc func(method string, route string, handler ContextHandler, middlewa
 
 // Walk walks any router tree that implements Routes interface.
 func Walk(r Routes, walkFn WalkFunc) error {
-	return walk(r, walkFn, "")
+	return walk(r, func(method string, route string, handler ContextHandler, meta Meta, middlewares ...*Middleware) error {
+		return walkFn(method, route, handler, middlewares...)
+	}, "", nil)
 }
 
-func walk(r Routes, walkFn WalkFunc, parentRoute string, parentMw ...*Middleware) error {
+// EndpointWalkFunc is the type of the function called for each endpoint handler
+// visited by WalkEndpoints.
+type EndpointWalkFunc func(method string, route string, variant EndpointVariant, middlewares ...*Middleware) error
+
+// WalkEndpoints walks the router tree like Walk, visiting each handler of the
+// endpoints with its constraints. The inline middlewares of the handler are
+// appended to the middlewares, and the metadata of the handler is merged down
+// from the routers and mount points, as seen at request time.
+func WalkEndpoints(r Routes, walkFn EndpointWalkFunc) error {
+	return walk(r, func(method string, route string, handler ContextHandler, meta Meta, middlewares ...*Middleware) error {
+		variants := []EndpointVariant{{Handler: handler}}
+		if eh, ok := handler.(*EndpointHandler); ok {
+			variants = eh.Variants()
+		}
+		for _, v := range variants {
+			v.Meta = meta.Merge(v.Meta)
+			mws := middlewares
+			if chain, ok := v.Handler.(*ChainHandler); ok {
+				mws = append(append([]*Middleware(nil), mws...), chain.Middlewares...)
+				v.Handler = chain.Endpoint
+			}
+			if err := walkFn(method, route, v, mws...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, "", nil)
+}
+
+func walk(r Routes, walkFn func(method string, route string, handler ContextHandler, meta Meta, middlewares ...*Middleware) error, parentRoute string, parentMeta Meta, parentMw ...*Middleware) error {
+	meta := parentMeta
+	if mr, ok := r.(interface{ Meta() Meta }); ok {
+		meta = meta.Merge(mr.Meta())
+	}
+
 	for _, route := range r.Routes() {
 		mws := make([]*Middleware, len(parentMw))
 		copy(mws, parentMw)
 		mws = append(mws, r.Middlewares()...)
 
 		if route.SubRoutes != nil {
-			if err := walk(route.SubRoutes, walkFn, parentRoute+route.Pattern, mws...); err != nil {
+			if err := walk(route.SubRoutes, walkFn, parentRoute+route.Pattern, meta.Merge(route.Meta["*"]), mws...); err != nil {
 				return err
 			}
 			continue
@@ -982,11 +1239,11 @@ func walk(r Routes, walkFn WalkFunc, parentRoute string, parentMw ...*Middleware
 			fullRoute := parentRoute + route.Pattern
 
 			if chain, ok := handler.(*ChainHandler); ok {
-				if err := walkFn(method, fullRoute, chain.Endpoint, append(mws, chain.Middlewares...)...); err != nil {
+				if err := walkFn(method, fullRoute, chain.Endpoint, meta, append(mws, chain.Middlewares...)...); err != nil {
 					return err
 				}
 			} else {
-				if err := walkFn(method, fullRoute, handler, mws...); err != nil {
+				if err := walkFn(method, fullRoute, handler, meta, mws...); err != nil {
 					return err
 				}
 			}
@@ -0,0 +1,277 @@
+package xroute
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fuzzInput consumes the fuzzer data. Exhausted input reads as zeros.
+type fuzzInput []byte
+
+func (in *fuzzInput) next() int {
+	if len(*in) == 0 {
+		return 0
+	}
+	b := (*in)[0]
+	*in = (*in)[1:]
+	return int(b)
+}
+
+func (in *fuzzInput) pick(n int) int {
+	return in.next() % n
+}
+
+var fuzzWords = []string{"a", "b", "ab", "ba", "abc", "1", "12", "x-y"}
+
+const (
+	fuzzRankStatic = iota
+	fuzzRankRegexp
+	fuzzRankParam
+	fuzzRankCatchAll
+)
+
+// refRoute is a route of the reference matcher.
+type refRoute struct {
+	pattern string
+	// shape is the pattern without param names
+	shape string
+	ranks []int
+	keys  []string
+	rex   *regexp.Regexp
+}
+
+// newRefRoute generates a route pattern from the input: static words, whole
+// segment params, whole segment digit regexps, an optional trailing slash
+// and an optional ending anonymous or named catch-all.
+func newRefRoute(in *fuzzInput, id int) *refRoute {
+	rt := &refRoute{}
+	var pattern, shape, rex strings.Builder
+	rex.WriteString("^")
+
+	n := 1 + in.pick(4)
+	for i := 0; i < n; i++ {
+		pattern.WriteByte('/')
+		shape.WriteByte('/')
+		rex.WriteByte('/')
+
+		key := "p" + string(rune('a'+i)) + string(rune('a'+id%26))
+		switch k := in.pick(8); {
+		case k < 4:
+			w := fuzzWords[in.pick(len(fuzzWords))]
+			pattern.WriteString(w)
+			shape.WriteString(w)
+			rex.WriteString(regexp.QuoteMeta(w))
+			rt.ranks = append(rt.ranks, fuzzRankStatic)
+		case k < 6:
+			pattern.WriteString("{" + key + "}")
+			shape.WriteString("{}")
+			rex.WriteString("([^/]+)")
+			rt.ranks = append(rt.ranks, fuzzRankParam)
+			rt.keys = append(rt.keys, key)
+		case k < 7:
+			pattern.WriteString("{" + key + ":[0-9]+}")
+			shape.WriteString("{:[0-9]+}")
+			rex.WriteString("([0-9]+)")
+			rt.ranks = append(rt.ranks, fuzzRankRegexp)
+			rt.keys = append(rt.keys, key)
+		default:
+			if i == n-1 {
+				// anonymous or named catch-all, on the same node
+				ckey := "*"
+				if in.pick(2) == 0 {
+					ckey = "c" + key[1:]
+					pattern.WriteString("{" + ckey + "...}")
+				} else {
+					pattern.WriteString("*")
+				}
+				shape.WriteString("*")
+				rex.WriteString("(.*)")
+				rt.ranks = append(rt.ranks, fuzzRankCatchAll)
+				rt.keys = append(rt.keys, ckey)
+			} else {
+				// trailing slash of a middle segment
+				pattern.WriteString("s")
+				shape.WriteString("s")
+				rex.WriteString("s")
+				rt.ranks = append(rt.ranks, fuzzRankStatic)
+			}
+		}
+	}
+	if rt.ranks[len(rt.ranks)-1] != fuzzRankCatchAll && in.pick(4) == 0 {
+		pattern.WriteByte('/')
+		shape.WriteByte('/')
+		rex.WriteByte('/')
+		rt.ranks = append(rt.ranks, fuzzRankStatic)
+	}
+	rex.WriteString("$")
+
+	rt.pattern, rt.shape = pattern.String(), shape.String()
+	rt.rex = regexp.MustCompile(rex.String())
+	return rt
+}
+
+// path returns a path for the route, using the input for param values.
+func (rt *refRoute) path(in *fuzzInput) string {
+	var values []string
+	for _, key := range rt.keys {
+		switch {
+		case key == "*" || key[0] == 'c':
+			values = append(values, strings.Repeat("z/", in.pick(3))+fuzzWords[in.pick(len(fuzzWords))])
+		case strings.Contains(rt.pattern, "{"+key+":"):
+			values = append(values, strings.Repeat("1", 1+in.pick(3)))
+		default:
+			values = append(values, fuzzWords[in.pick(len(fuzzWords))])
+		}
+	}
+	var i int
+	return regexp.MustCompile(`\{[^}]+\}|\*`).ReplaceAllStringFunc(rt.pattern, func(string) string {
+		i++
+		return values[i-1]
+	})
+}
+
+// refMatch is the reference matcher: the route with the lowest segment ranks
+// (static, then regexp, then param, then catch-all) that matches the path.
+func refMatch(routes []*refRoute, path string) (best *refRoute, params []string) {
+	for _, rt := range routes {
+		m := rt.rex.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		if best == nil || refLess(rt.ranks, best.ranks) {
+			best, params = rt, m[1:]
+		}
+	}
+	return
+}
+
+func refLess(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func FuzzTreeReference(f *testing.F) {
+	f.Add([]byte{3, 0, 1, 4, 2, 5, 6, 7, 1, 0, 2})
+	f.Add([]byte{5, 2, 0, 3, 4, 1, 5, 2, 1, 7, 3, 0, 6, 1, 2, 7, 7, 3})
+	f.Add([]byte("/article/{id}/edit"))
+	f.Add([]byte("/admin/apps/{id}/*"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		in := fuzzInput(data)
+
+		// routes with unique shapes
+		var routes []*refRoute
+		shapes := map[string]bool{}
+		for i, n := 0, 1+in.pick(12); i < n; i++ {
+			rt := newRefRoute(&in, i)
+			if !shapes[rt.shape] {
+				shapes[rt.shape] = true
+				routes = append(routes, rt)
+			}
+		}
+
+		// random insertion order
+		order := append([]*refRoute(nil), routes...)
+		for i := len(order) - 1; i > 0; i-- {
+			j := in.pick(i + 1)
+			order[i], order[j] = order[j], order[i]
+		}
+
+		tr := &node{}
+		handlers := map[ContextHandler]*refRoute{}
+		for _, rt := range order {
+			h := &HTTPHandlerFunc{func(w http.ResponseWriter, r *http.Request) {}}
+			handlers[h] = rt
+			tr.InsertRoute(false, GET, rt.pattern, h)
+		}
+
+		var paths []string
+		for _, rt := range routes {
+			paths = append(paths, rt.path(&in))
+		}
+		for i, n := 0, in.pick(4); i < n; i++ {
+			var b strings.Builder
+			for j, m := 0, 1+in.pick(4); j < m; j++ {
+				b.WriteString("/" + fuzzWords[in.pick(len(fuzzWords))])
+			}
+			paths = append(paths, b.String())
+		}
+
+		for _, path := range paths {
+			rctx := NewRouteContext()
+			_, _, h := tr.FindRoute(rctx, GET, path)
+			if eh, ok := h.(*EndpointHandler); ok {
+				h = eh.Variants()[0].Handler
+			}
+			expected, params := refMatch(routes, path)
+
+			if expected == nil {
+				if h != nil {
+					t.Fatalf("%q: expected no match, got %q", path, handlers[h].pattern)
+				}
+				continue
+			}
+			if h == nil {
+				t.Fatalf("%q: expected %q, got no match", path, expected.pattern)
+			}
+			if got := handlers[h]; got != expected {
+				t.Fatalf("%q: expected %q, got %q", path, expected.pattern, got.pattern)
+			}
+			if rctx.routePattern != expected.pattern {
+				t.Fatalf("%q: expected pattern %q, got %q", path, expected.pattern, rctx.routePattern)
+			}
+			if !stringSliceEqual(rctx.routeParams.Keys, expected.keys) || !stringSliceEqual(rctx.routeParams.Values, params) {
+				t.Fatalf("%q: pattern %q: expected params %q=%q, got %q=%q", path, expected.pattern,
+					expected.keys, params, rctx.routeParams.Keys, rctx.routeParams.Values)
+			}
+		}
+	})
+}
+
+// FuzzTreeFindRoute checks arbitrary paths against the TestTree routes never
+// panic, and matched params are consistent with the matched pattern.
+func FuzzTreeFindRoute(f *testing.F) {
+	patterns := []string{
+		"/", "/favicon.ico", "/pages/*", "/article", "/article/", "/article/near",
+		"/article/{id}", "/article/@{user}", "/article/{id}/{opts}", "/article/{iffd}/edit",
+		"/article/{id}//related", "/article/slug/{month}/-/{day}/{year}", "/admin/user",
+		"/admin/user/", "/admin/user//{id}", "/admin/user/{id}", "/admin/apps/{id}",
+		"/admin/apps/{id}/*", "/admin/*", "/users/{userID}/profile", "/users/super/*",
+		"/users/*", "/hubs/{hubID}/view", "/hubs/{hubID}/view/*", "/hubs/{hubID}/users",
+		"/articles/{slug:^[a-z]+}/posts", "/articles/{id:^[0-9]+}", "/articles/{id:^[0-9]+}/{opts}",
+		"/date/{yyyy:^[0-9]{4}}/{mm:^[0-9]{2}}", "/images/{id}.png", "/images/{id}-{size}.jpg",
+		"/files/{name}", "/files/{path...}/raw", "/files/{path...}/v/{version:^[0-9]+}",
+		"/docs/{lang?}/{page?}",
+	}
+	tr := &node{}
+	for _, p := range patterns {
+		tr.InsertRoute(true, GET, p, &HTTPHandlerFunc{func(w http.ResponseWriter, r *http.Request) {}})
+	}
+
+	for _, p := range patterns {
+		f.Add(strings.NewReplacer("{", "", "}", "", "?", "", "...", "/x", "*", "x/y").Replace(p))
+	}
+
+	f.Fuzz(func(t *testing.T, path string) {
+		rctx := NewRouteContext()
+		_, _, h := tr.FindRoute(rctx, GET, path)
+		if h == nil {
+			return
+		}
+		if len(rctx.routeParams.Keys) != len(rctx.routeParams.Values) {
+			t.Fatalf("%q: pattern %q: params %q=%q", path, rctx.routePattern, rctx.routeParams.Keys, rctx.routeParams.Values)
+		}
+		// values may be empty: the .json API extension is trimmed from them
+		for i, v := range rctx.routeParams.Values {
+			if key := rctx.routeParams.Keys[i]; key != "*" && key != "path" && strings.Contains(v, "/") {
+				t.Fatalf("%q: pattern %q: bad param %s=%q", path, rctx.routePattern, rctx.routeParams.Keys[i], v)
+			}
+		}
+	})
+}
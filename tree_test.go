@@ -358,6 +358,147 @@ func TestTreeRegexMatchWholeParam(t *testing.T) {
 	}
 }
 
+func TestTreeOptionalAndCatchAll(t *testing.T) {
+	hStub1 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub2 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub3 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub4 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub5 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub6 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub7 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub8 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+	hStub9 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	tr := &node{}
+	tr.InsertRoute(true, GET, "/users/{id?}/{tab?:^[a-z]+}", hStub1)
+	tr.InsertRoute(true, GET, "/users/me", hStub2)
+	tr.InsertRoute(true, GET, "/files/{path...}", hStub3)
+	tr.InsertRoute(true, GET, "/files/{path...}/raw", hStub4)
+	tr.InsertRoute(true, GET, "/files/{name}", hStub5)
+	tr.InsertRoute(true, GET, "/files/{path...}/v/{version:^[0-9]+}", hStub6)
+	tr.InsertRoute(true, GET, "/static/{rest:*}", hStub7)
+	tr.InsertRoute(true, GET, "/static/favicon.ico", hStub8)
+	tr.InsertRoute(true, GET, "/docs/{lang?}.json", hStub9)
+
+	tests := []struct {
+		r string         // input request path
+		h ContextHandler // output matched handler
+		p string         // output route pattern
+		k []string       // output param keys
+		v []string       // output param values
+	}{
+		{r: "/users", h: hStub1, p: "/users/{id?}/{tab?:^[a-z]+}", k: []string{}, v: []string{}},
+		{r: "/users/7", h: hStub1, p: "/users/{id?}/{tab?:^[a-z]+}", k: []string{"id"}, v: []string{"7"}},
+		{r: "/users/7/posts", h: hStub1, p: "/users/{id?}/{tab?:^[a-z]+}", k: []string{"id", "tab"}, v: []string{"7", "posts"}},
+		{r: "/users/7/12", h: nil, k: []string{}, v: []string{}},
+		{r: "/users/me", h: hStub2, p: "/users/me", k: []string{}, v: []string{}},
+		{r: "/users/me/posts", h: hStub1, p: "/users/{id?}/{tab?:^[a-z]+}", k: []string{"id", "tab"}, v: []string{"me", "posts"}},
+		{r: "/files/a.txt", h: hStub5, p: "/files/{name}", k: []string{"name"}, v: []string{"a.txt"}},
+		{r: "/files/a/b.txt", h: hStub3, p: "/files/{path...}", k: []string{"path"}, v: []string{"a/b.txt"}},
+		{r: "/files/a.txt/raw", h: hStub4, p: "/files/{path...}/raw", k: []string{"path"}, v: []string{"a.txt"}},
+		{r: "/files/a/raw/b/raw", h: hStub4, p: "/files/{path...}/raw", k: []string{"path"}, v: []string{"a/raw/b"}},
+		{r: "/files/a/b/v/2", h: hStub6, p: "/files/{path...}/v/{version:^[0-9]+}", k: []string{"path", "version"}, v: []string{"a/b", "2"}},
+		{r: "/files/a/b/v/x", h: hStub3, p: "/files/{path...}", k: []string{"path"}, v: []string{"a/b/v/x"}},
+		{r: "/files/raw", h: hStub5, p: "/files/{name}", k: []string{"name"}, v: []string{"raw"}},
+		{r: "/static/css/site.css", h: hStub7, p: "/static/{rest:*}", k: []string{"rest"}, v: []string{"css/site.css"}},
+		{r: "/static/favicon.ico", h: hStub8, p: "/static/favicon.ico", k: []string{}, v: []string{}},
+		{r: "/docs/en.json", h: hStub9, p: "/docs/{lang?}.json", k: []string{"lang"}, v: []string{"en"}},
+		{r: "/docs.json", h: hStub9, p: "/docs/{lang?}.json", k: []string{}, v: []string{}},
+	}
+
+	for i, tt := range tests {
+		rctx := NewRouteContext()
+
+		_, handlers, _ := tr.FindRoute(rctx, GET, tt.r)
+
+		var handler ContextHandler
+		if methodHandler, ok := handlers[GET]; ok {
+			handler = methodHandler.handler.Handler(nil)
+		}
+
+		paramKeys := rctx.routeParams.Keys
+		paramValues := rctx.routeParams.Values
+
+		if fmt.Sprintf("%v", tt.h) != fmt.Sprintf("%v", handler) {
+			t.Errorf("input [%d]: find '%s' expecting handler:%v , got:%v", i, tt.r, tt.h, handler)
+		}
+		if tt.p != rctx.routePattern {
+			t.Errorf("input [%d]: find '%s' expecting pattern:%s , got:%s", i, tt.r, tt.p, rctx.routePattern)
+		}
+		if !stringSliceEqual(tt.k, paramKeys) {
+			t.Errorf("input [%d]: find '%s' expecting paramKeys:(%d)%v , got:(%d)%v", i, tt.r, len(tt.k), tt.k, len(paramKeys), paramKeys)
+		}
+		if !stringSliceEqual(tt.v, paramValues) {
+			t.Errorf("input [%d]: find '%s' expecting paramValues:(%d)%v , got:(%d)%v", i, tt.r, len(tt.v), tt.v, len(paramValues), paramValues)
+		}
+	}
+
+	var patterns []string
+	for _, rt := range tr.routes() {
+		if rt.Pattern == "/users/{id?}/{tab?:^[a-z]+}" || rt.Pattern == "/docs/{lang?}.json" {
+			patterns = append(patterns, rt.Pattern)
+		}
+	}
+	if len(patterns) != 2 {
+		t.Errorf("expecting optional patterns listed once, got %v", patterns)
+	}
+}
+
+func TestTreeBadOptionalPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"/users/{id?}/posts",
+		"/users/{id?}/{tab}",
+		"/users/x{id?}",
+		"/users/{id?}/x/{tab?}",
+		"/files/{path...}{name}",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("pattern '%s': expecting a panic", pattern)
+				}
+			}()
+			tr := &node{}
+			tr.InsertRoute(true, GET, pattern, HttpHandler(func(w http.ResponseWriter, r *http.Request) {}))
+		}()
+	}
+}
+
+func TestBuildPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  map[string]string
+		path    string
+		err     bool
+	}{
+		{pattern: "/", path: "/"},
+		{pattern: "/users/{id}", params: map[string]string{"id": "a b"}, path: "/users/a%20b"},
+		{pattern: "/users/{id}", err: true},
+		{pattern: "/users/{id:^[0-9]+}", params: map[string]string{"id": "12"}, path: "/users/12"},
+		{pattern: "/users/{id:^[0-9]+}", params: map[string]string{"id": "x"}, err: true},
+		{pattern: "/users/{id?}/{tab?}", params: map[string]string{"id": "7"}, path: "/users/7"},
+		{pattern: "/users/{id?}/{tab?}", path: "/users"},
+		{pattern: "/users/{id?}/{tab?}", params: map[string]string{"tab": "posts"}, err: true},
+		{pattern: "/docs/{lang?}.json", path: "/docs.json"},
+		{pattern: "/{id?}", path: "/"},
+		{pattern: "/files/{path...}/raw", params: map[string]string{"path": "a/b c.txt"}, path: "/files/a/b%20c.txt/raw"},
+		{pattern: "/static/{rest:*}", params: map[string]string{"rest": "css/site.css"}, path: "/static/css/site.css"},
+		{pattern: "/admin/*", params: map[string]string{"*": "apps/1"}, path: "/admin/apps/1"},
+	}
+	for i, tt := range tests {
+		path, err := BuildPath(tt.pattern, tt.params)
+		if tt.err {
+			if err == nil {
+				t.Errorf("input [%d]: '%s' expecting an error, got:%s", i, tt.pattern, path)
+			}
+			continue
+		}
+		if err != nil || path != tt.path {
+			t.Errorf("input [%d]: '%s' expecting path:%s , got:%s (%v)", i, tt.pattern, tt.path, path, err)
+		}
+	}
+}
+
 func TestTreeFindPattern(t *testing.T) {
 	hStub1 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
 	hStub2 := HttpHandler(func(w http.ResponseWriter, r *http.Request) {})
@@ -0,0 +1,338 @@
+// Package upload parses multipart form bodies as they are read, spooling
+// the files to a temporary directory, with per-part and total size limits and
+// content type allow-lists.
+//
+//	up := upload.New()
+//	up.AllowedTypes = []string{"image/png", "image/jpeg"}
+//	r.With(up.Middleware()).Post("/avatars", func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+//		for _, f := range upload.Files(rctx, "avatar") {
+//			err := f.Move(filepath.Join(avatarsDir, id))
+//			...
+//		}
+//	})
+//
+// Only the methods accepted by the routers (see
+// xroute.Mux.AcceptMultipartForm) can send multipart bodies: the ones of the
+// nearest router that sets MultipartFormMethods, such as the root router of
+// mounted routers. The files not moved are removed when the request ends.
+package upload
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Name is the name of the upload middleware.
+const Name = "upload"
+
+const (
+	// DefaultMaxPartSize is the default size limit of a file.
+	DefaultMaxPartSize = 32 << 20
+
+	// DefaultMaxTotalSize is the default size limit of the body.
+	DefaultMaxTotalSize = 128 << 20
+
+	// DefaultMaxValueSize is the default size limit of a value, which is
+	// kept in memory.
+	DefaultMaxValueSize = 1 << 20
+
+	// DefaultMaxParts is the default limit of parts.
+	DefaultMaxParts = 100
+)
+
+var (
+	ErrMethod       = xroute.NewHTTPError(http.StatusUnsupportedMediaType, errors.New("upload: multipart body not accepted for the method"))
+	ErrPartTooLarge = xroute.NewHTTPError(http.StatusRequestEntityTooLarge, errors.New("upload: part too large"))
+	ErrTooLarge     = xroute.NewHTTPError(http.StatusRequestEntityTooLarge, errors.New("upload: body too large"))
+	ErrTooManyParts = xroute.NewHTTPError(http.StatusRequestEntityTooLarge, errors.New("upload: too many parts"))
+	ErrContentType  = xroute.NewHTTPError(http.StatusUnsupportedMediaType, errors.New("upload: file content type not allowed"))
+	ErrNoBoundary   = xroute.NewHTTPError(http.StatusBadRequest, errors.New("upload: missing multipart boundary"))
+)
+
+type formKey struct{}
+
+// File is an uploaded file, spooled to a temporary file.
+type File struct {
+	Field       string
+	Filename    string
+	ContentType string
+	Size        int64
+	Header      textproto.MIMEHeader
+
+	// Path is the path of the temporary file.
+	Path string
+
+	moved bool
+}
+
+// Open opens the temporary file.
+func (f *File) Open() (*os.File, error) {
+	return os.Open(f.Path)
+}
+
+// Move moves the temporary file to `path`, so it isn't removed when the
+// request ends.
+func (f *File) Move(path string) error {
+	if err := os.Rename(f.Path, path); err != nil {
+		return err
+	}
+	f.Path, f.moved = path, true
+	return nil
+}
+
+// Form is a parsed multipart form.
+type Form struct {
+	Values url.Values
+	Files  map[string][]*File
+}
+
+// RemoveAll removes the temporary files not moved.
+func (f *Form) RemoveAll() (err error) {
+	for _, files := range f.Files {
+		for _, file := range files {
+			if !file.moved {
+				if e := os.Remove(file.Path); e != nil && !os.IsNotExist(e) && err == nil {
+					err = e
+				}
+			}
+		}
+	}
+	return
+}
+
+// FormOf returns the multipart form of the request, or nil.
+func FormOf(rctx *xroute.RouteContext) *Form {
+	if rctx != nil {
+		if f, ok := rctx.Data[formKey{}].(*Form); ok {
+			return f
+		}
+	}
+	return nil
+}
+
+// Files returns the files of the `field`.
+func Files(rctx *xroute.RouteContext, field string) []*File {
+	if f := FormOf(rctx); f != nil {
+		return f.Files[field]
+	}
+	return nil
+}
+
+// Value returns the first value of the `field`.
+func Value(rctx *xroute.RouteContext, field string) string {
+	if f := FormOf(rctx); f != nil {
+		return f.Values.Get(field)
+	}
+	return ""
+}
+
+// Uploader parses the multipart form bodies.
+type Uploader struct {
+	// TempDir is the directory of the temporary files. Defaults to
+	// os.TempDir.
+	TempDir string
+
+	// MaxPartSize is the size limit of a file. Defaults to
+	// DefaultMaxPartSize.
+	MaxPartSize int64
+
+	// MaxTotalSize is the size limit of the files and values. Defaults to
+	// DefaultMaxTotalSize.
+	MaxTotalSize int64
+
+	// MaxValueSize is the size limit of a value. Defaults to
+	// DefaultMaxValueSize.
+	MaxValueSize int64
+
+	// MaxParts is the limit of parts. Defaults to DefaultMaxParts.
+	MaxParts int
+
+	// AllowedTypes are the allowed declared content types of the files,
+	// such as `image/png` or `image/*`. Empty allows any.
+	AllowedTypes []string
+}
+
+// New returns a new uploader with the default limits.
+func New() *Uploader {
+	return &Uploader{}
+}
+
+// Middleware returns the named upload middleware. It must run after routing:
+// attach it with With, Group or HandlerIntersept.
+func (u *Uploader) Middleware() *xroute.Middleware {
+	return &xroute.Middleware{Name: Name, Handler: u.Handler}
+}
+
+// Handler is the upload middleware handler. Requests without multipart body
+// are passed through.
+func (u *Uploader) Handler(chain *xroute.ChainHandler) {
+	r, rctx := chain.Request(), chain.Context
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		chain.Next()
+		return
+	}
+	if !acceptMultipart(rctx, r.Method) {
+		xroute.ServeError(chain.Writer, r, rctx, ErrMethod)
+		return
+	}
+	if params["boundary"] == "" {
+		xroute.ServeError(chain.Writer, r, rctx, ErrNoBoundary)
+		return
+	}
+
+	form, err := u.Parse(multipart.NewReader(r.Body, params["boundary"]))
+	if err != nil {
+		// errors of the body reader, such as xroute.ErrBodyTooLarge, keep
+		// their status
+		herr := &xroute.HTTPError{}
+		if !errors.As(err, &herr) {
+			herr = xroute.NewHTTPError(http.StatusBadRequest, err)
+		}
+		xroute.ServeError(chain.Writer, r, rctx, herr)
+		return
+	}
+	defer func() {
+		if err := form.RemoveAll(); err != nil && rctx.Log != nil {
+			rctx.Log.Errorf("upload: remove temporary files failed: %v", err)
+		}
+	}()
+	rctx.Data[formKey{}] = form
+	chain.Next()
+}
+
+// acceptMultipart reports whether the nearest router that sets
+// MultipartFormMethods accepts the multipart bodies of the method.
+func acceptMultipart(rctx *xroute.RouteContext, method string) bool {
+	for i := len(rctx.RouterStack) - 1; i >= 0; i-- {
+		if mx, ok := rctx.RouterStack[i].(*xroute.Mux); ok && mx.MultipartFormMethods != nil {
+			return mx.AcceptMultipartForm(method)
+		}
+	}
+	return method == http.MethodPost || method == http.MethodPut
+}
+
+// Parse reads the parts of `mr`. On errors, the spooled files are removed.
+func (u *Uploader) Parse(mr *multipart.Reader) (*Form, error) {
+	form := &Form{Values: url.Values{}, Files: map[string][]*File{}}
+	if err := u.parse(mr, form); err != nil {
+		form.RemoveAll()
+		return nil, err
+	}
+	return form, nil
+}
+
+func (u *Uploader) parse(mr *multipart.Reader, form *Form) error {
+	maxParts := u.MaxParts
+	if maxParts <= 0 {
+		maxParts = DefaultMaxParts
+	}
+	remaining := or(u.MaxTotalSize, DefaultMaxTotalSize)
+
+	for parts := 0; ; parts++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if parts == maxParts {
+			part.Close()
+			return ErrTooManyParts
+		}
+
+		name := part.FormName()
+		if part.FileName() == "" {
+			limit := or(u.MaxValueSize, DefaultMaxValueSize)
+			value, err := ioutil.ReadAll(io.LimitReader(part, limit+1))
+			part.Close()
+			switch {
+			case err != nil:
+				return err
+			case int64(len(value)) > limit:
+				return ErrPartTooLarge
+			case int64(len(value)) > remaining:
+				return ErrTooLarge
+			}
+			remaining -= int64(len(value))
+			form.Values.Add(name, string(value))
+			continue
+		}
+
+		file := &File{Field: name, Filename: part.FileName(), ContentType: part.Header.Get("Content-Type"), Header: part.Header}
+		if !u.allowed(file.ContentType) {
+			part.Close()
+			return ErrContentType
+		}
+		err = u.spool(file, part, &remaining)
+		part.Close()
+		if file.Path != "" {
+			form.Files[name] = append(form.Files[name], file)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// spool copies the part to a temporary file, up to the part limit and the
+// `remaining` total size.
+func (u *Uploader) spool(file *File, part io.Reader, remaining *int64) error {
+	f, err := ioutil.TempFile(u.TempDir, "upload-")
+	if err != nil {
+		return err
+	}
+	file.Path = f.Name()
+	limit := or(u.MaxPartSize, DefaultMaxPartSize)
+	if *remaining < limit {
+		limit = *remaining
+	}
+	file.Size, err = io.Copy(f, io.LimitReader(part, limit+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+		return err
+	case file.Size > *remaining:
+		return ErrTooLarge
+	case file.Size > limit:
+		return ErrPartTooLarge
+	}
+	*remaining -= file.Size
+	return nil
+}
+
+func (u *Uploader) allowed(contentType string) bool {
+	if len(u.AllowedTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range u.AllowedTypes {
+		if allowed == mediaType || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, allowed[:len(allowed)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func or(v, defaultValue int64) int64 {
+	if v <= 0 {
+		return defaultValue
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+package upload
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+type part struct {
+	field, filename, contentType, body string
+}
+
+func newRequest(method string, parts ...part) *http.Request {
+	return newPathRequest(method, "/avatars", parts...)
+}
+
+func newPathRequest(method, path string, parts ...part) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		if p.filename == "" {
+			mw.WriteField(p.field, p.body)
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.filename+`"`)
+		h.Set("Content-Type", p.contentType)
+		w, _ := mw.CreatePart(h)
+		w.Write([]byte(p.body))
+	}
+	mw.Close()
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploader(t *testing.T) {
+	dir, keep := t.TempDir(), t.TempDir()
+	up := New()
+	up.TempDir = dir
+	up.MaxPartSize = 10
+	up.MaxTotalSize = 16
+	up.AllowedTypes = []string{"image/*"}
+
+	var paths []string
+	r := xroute.NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+		paths = nil
+		for _, f := range Files(rctx, "avatar") {
+			data, _ := ioutil.ReadFile(f.Path)
+			w.Write([]byte(Value(rctx, "name") + ":" + f.Filename + ":" + string(data) + ";"))
+			paths = append(paths, f.Path)
+			if f.Filename == "keep.png" {
+				f.Move(filepath.Join(keep, f.Filename))
+			}
+		}
+	}
+	r.With(up.Middleware()).Post("/avatars", handler)
+	r.With(up.Middleware()).Patch("/avatars", handler)
+	r.With(xroute.BodyLimit(100), up.Middleware()).Put("/avatars", handler)
+
+	tests := []struct {
+		method string
+		parts  []part
+		status int
+		body   string
+	}{
+		{"POST", []part{{"name", "", "", "ann"}, {"avatar", "a.png", "image/png", "png"}, {"avatar", "keep.png", "image/png", "keep"}}, 200, "ann:a.png:png;ann:keep.png:keep;"},
+		{"POST", []part{{"avatar", "a.exe", "application/octet-stream", "MZ"}}, 415, ""},
+		{"POST", []part{{"avatar", "a.png", "image/png", "0123456789a"}}, 413, ""},
+		{"POST", []part{{"avatar", "a.png", "image/png", "0123456789"}, {"avatar", "b.png", "image/png", "0123456789"}}, 413, ""},
+		{"PATCH", []part{{"avatar", "a.png", "image/png", "png"}}, 415, ""},
+		{"PUT", []part{{"name", "", "", strings.Repeat("a", 200)}}, 413, ""},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newRequest(tt.method, tt.parts...))
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body {
+			t.Fatalf("input [%d]: expecting %d %q, got %d %q", i, tt.status, tt.body, w.Code, w.Body.String())
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Fatalf("input [%d]: expecting temporary files removed, got %d", i, len(files))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(keep, "keep.png")); err != nil {
+		t.Fatalf("expecting moved file kept: %v", err)
+	}
+
+	r.MultipartFormMethods = []string{"PATCH"}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newRequest("PATCH", part{"avatar", "a.png", "image/png", "png"}))
+	if w.Code != 200 {
+		t.Fatalf("expecting PATCH accepted, got %d", w.Code)
+	}
+
+	// mounted routers use the methods of the root router
+	api := xroute.NewRouter()
+	api.With(up.Middleware()).Patch("/avatars", handler)
+	r.Mount("/api", api)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newPathRequest("PATCH", "/api/avatars", part{"avatar", "a.png", "image/png", "png"}))
+	if w.Code != 200 {
+		t.Fatalf("expecting PATCH accepted by the mounted router, got %d", w.Code)
+	}
+	api.MultipartFormMethods = []string{"PUT"}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, newPathRequest("PATCH", "/api/avatars", part{"avatar", "a.png", "image/png", "png"}))
+	if w.Code != 415 {
+		t.Fatalf("expecting PATCH refused by the mounted router, got %d", w.Code)
+	}
+}
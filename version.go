@@ -0,0 +1,125 @@
+package xroute
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versioning configures how the API version of the requests to the routes
+// registered by Router.Version is read. The version is read from the path
+// prefix, then from the custom header, then from the Accept media type.
+type Versioning struct {
+	// PathPrefix enables versions as the first path segment, such as
+	// /v2/users. The prefix is removed from the routing path.
+	PathPrefix bool
+
+	// Header is the custom version header, such as Accept-Version: 2.
+	Header string
+
+	// Vendor is the vendor of the Accept media type versions, such as x in
+	// application/vnd.x.v2+json. Empty accepts any vendor.
+	Vendor string
+
+	// Default is the version of requests without one. Empty selects the
+	// latest version of each route.
+	Default string
+
+	// Deprecations are the retired versions. Responses to requests of a
+	// retired version have the Deprecation, Sunset and Link headers.
+	Deprecations map[string]Deprecation
+}
+
+// Deprecation is the retirement of a version.
+type Deprecation struct {
+	// At is the deprecation date. Zero means deprecated with no date.
+	At time.Time
+	// Sunset is the date the version stops working, if not zero.
+	Sunset time.Time
+	// Link is the URL of the deprecation notice, if not empty.
+	Link string
+}
+
+// DefaultVersioning is the versioning of the routers without one.
+var DefaultVersioning = &Versioning{PathPrefix: true, Header: "Accept-Version"}
+
+var (
+	versionPathRegexp  = regexp.MustCompile(`^/v([0-9]+(?:\.[0-9]+)*)(/|$)`)
+	versionMediaRegexp = regexp.MustCompile(`vnd\.(.+)\.v([0-9]+(?:\.[0-9]+)*)(\+|;|$)`)
+)
+
+// resolve sets the requested version to the route context and returns the
+// routing path, without the version prefix.
+func (v *Versioning) resolve(w http.ResponseWriter, r *http.Request, rctx *RouteContext, routePath string) string {
+	var version string
+	if v.PathPrefix {
+		if m := versionPathRegexp.FindStringSubmatch(routePath); m != nil {
+			version = m[1]
+			routePath = "/" + routePath[len(m[0]):]
+		}
+	}
+	if version == "" && v.Header != "" {
+		version = strings.TrimPrefix(strings.TrimSpace(r.Header.Get(v.Header)), "v")
+	}
+	if version == "" {
+		version = v.mediaTypeVersion(r.Header.Get("Accept"))
+	}
+	if version == "" {
+		version = v.Default
+	}
+	rctx.APIVersion = version
+
+	if d, ok := v.Deprecations[version]; ok {
+		d.setHeaders(w.Header())
+	}
+	return routePath
+}
+
+func (v *Versioning) mediaTypeVersion(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		if m := versionMediaRegexp.FindStringSubmatch(strings.TrimSpace(mediaRange)); m != nil {
+			if v.Vendor == "" || m[1] == v.Vendor {
+				return m[2]
+			}
+		}
+	}
+	return ""
+}
+
+func (d Deprecation) setHeaders(h http.Header) {
+	if d.At.IsZero() {
+		h.Set("Deprecation", "true")
+	} else {
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.At.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		h.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+}
+
+// CompareVersions compares the dot separated numeric versions `a` and `b`,
+// returning -1, 0 or +1. Missing parts are zeros: 2 equals 2.0.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,432 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Opcode is the frame opcode defined by RFC 6455, section 5.2.
+type Opcode byte
+
+const (
+	ContinuationFrame Opcode = 0x0
+	TextMessage       Opcode = 0x1
+	BinaryMessage     Opcode = 0x2
+	CloseMessage      Opcode = 0x8
+	PingMessage       Opcode = 0x9
+	PongMessage       Opcode = 0xA
+)
+
+// IsControl returns true for the close, ping and pong opcodes.
+func (op Opcode) IsControl() bool {
+	return op&0x8 != 0
+}
+
+// Close codes defined by RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	// DefaultReadLimit is the default maximum size of a read message.
+	DefaultReadLimit int64 = 32 << 20
+
+	maxControlPayload = 125
+	closeTimeout      = 5 * time.Second
+)
+
+var (
+	// ErrCloseSent is returned when writing after a close frame was sent.
+	ErrCloseSent = errors.New("websocket: close sent")
+)
+
+// CloseError is returned by the read methods when a close frame is received.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+// Frame is a single websocket frame. Payloads are always unmasked.
+type Frame struct {
+	Fin     bool
+	Opcode  Opcode
+	Payload []byte
+}
+
+// Conn is a websocket connection.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+
+	writeMu   sync.Mutex
+	closeSent bool
+	closeOnce sync.Once
+
+	// Request is the handshake request. It is nil for client connections.
+	Request *http.Request
+
+	// Context is the routing context of the handshake request. It is nil for
+	// client connections.
+	Context *xroute.RouteContext
+
+	// Subprotocol is the negotiated subprotocol.
+	Subprotocol string
+
+	// ReadLimit is the maximum size in bytes of a read message.
+	ReadLimit int64
+
+	// PingHandler is called for received ping frames. The default handler
+	// replies with a pong frame with the same payload.
+	PingHandler func(data []byte) error
+
+	// PongHandler is called for received pong frames. The default handler
+	// does nothing.
+	PongHandler func(data []byte) error
+
+	// CloseHandler is called for received close frames before ReadMessage
+	// returns a *CloseError. The default handler echoes the close code.
+	CloseHandler func(code int, text string) error
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	c := &Conn{conn: conn, br: br, client: client, ReadLimit: DefaultReadLimit}
+	c.PingHandler = func(data []byte) error {
+		err := c.WriteControl(PongMessage, data)
+		if err == ErrCloseSent {
+			return nil
+		}
+		return err
+	}
+	c.CloseHandler = func(code int, text string) error {
+		if code == CloseNoStatusReceived {
+			code = CloseNormalClosure
+		}
+		err := c.writeClose(code, "")
+		if err == ErrCloseSent {
+			return nil
+		}
+		return err
+	}
+	return c
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// URLParam returns the URL parameter `key` of the handshake request.
+func (c *Conn) URLParam(key string) string {
+	if c.Context == nil {
+		return ""
+	}
+	return c.Context.URLParam(key)
+}
+
+// SetReadDeadline sets the read deadline on the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline on the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadFrame reads the next frame without handling control frames or
+// reassembling fragmented messages.
+func (c *Conn) ReadFrame() (*Frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return nil, err
+	}
+
+	f := &Frame{Fin: head[0]&0x80 != 0, Opcode: Opcode(head[0] & 0x0f)}
+	if head[0]&0x70 != 0 {
+		return nil, c.protocolError(CloseProtocolError, "unexpected reserved bits")
+	}
+
+	switch f.Opcode {
+	case ContinuationFrame, TextMessage, BinaryMessage, CloseMessage, PingMessage, PongMessage:
+	default:
+		return nil, c.protocolError(CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.Opcode))
+	}
+
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		if c.client {
+			return nil, c.protocolError(CloseProtocolError, "masked server frame")
+		}
+		return nil, c.protocolError(CloseProtocolError, "unmasked client frame")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(b[:]))
+		if length < 0 {
+			return nil, c.protocolError(CloseProtocolError, "invalid payload length")
+		}
+	}
+
+	if f.Opcode.IsControl() && (length > maxControlPayload || !f.Fin) {
+		return nil, c.protocolError(CloseProtocolError, "invalid control frame")
+	}
+	if c.ReadLimit > 0 && length > c.ReadLimit {
+		return nil, c.protocolError(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	f.Payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.Payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(mask, f.Payload)
+	}
+	return f, nil
+}
+
+// WriteFrame writes a single frame. Client frames are masked.
+func (c *Conn) WriteFrame(f *Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if f.Opcode == CloseMessage {
+		c.closeSent = true
+	}
+	return c.writeFrame(f)
+}
+
+func (c *Conn) writeFrame(f *Frame) error {
+	length := len(f.Payload)
+	buf := make([]byte, 0, 14+length)
+
+	b0 := byte(f.Opcode)
+	if f.Fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var b1 byte
+	if c.client {
+		b1 = 0x80
+	}
+	switch {
+	case length <= 125:
+		buf = append(buf, b1|byte(length))
+	case length <= 0xffff:
+		buf = append(buf, b1|126, byte(length>>8), byte(length))
+	default:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, f.Payload...)
+		maskBytes(mask, buf[start:])
+	} else {
+		buf = append(buf, f.Payload...)
+	}
+
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// ReadMessage reads the next data message. Control frames received in the
+// meantime are dispatched to the ping, pong and close handlers. When a close
+// frame is received, a *CloseError is returned.
+func (c *Conn) ReadMessage() (typ Opcode, data []byte, err error) {
+	for {
+		var f *Frame
+		if f, err = c.ReadFrame(); err != nil {
+			return
+		}
+
+		switch f.Opcode {
+		case PingMessage:
+			if c.PingHandler != nil {
+				if err = c.PingHandler(f.Payload); err != nil {
+					return
+				}
+			}
+			continue
+		case PongMessage:
+			if c.PongHandler != nil {
+				if err = c.PongHandler(f.Payload); err != nil {
+					return
+				}
+			}
+			continue
+		case CloseMessage:
+			code, text := CloseNoStatusReceived, ""
+			if len(f.Payload) == 1 {
+				return 0, nil, c.protocolError(CloseProtocolError, "invalid close payload")
+			} else if len(f.Payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(f.Payload))
+				text = string(f.Payload[2:])
+				if !utf8.ValidString(text) {
+					return 0, nil, c.protocolError(CloseInvalidFramePayloadData, "invalid utf8 close text")
+				}
+			}
+			if c.CloseHandler != nil {
+				if err = c.CloseHandler(code, text); err != nil {
+					return
+				}
+			}
+			return 0, nil, &CloseError{Code: code, Text: text}
+		case ContinuationFrame:
+			if typ == 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			if typ != 0 {
+				return 0, nil, c.protocolError(CloseProtocolError, "expected continuation frame")
+			}
+			typ = f.Opcode
+		}
+
+		if c.ReadLimit > 0 && int64(len(data)+len(f.Payload)) > c.ReadLimit {
+			return 0, nil, c.protocolError(CloseMessageTooBig, "message too big")
+		}
+		data = append(data, f.Payload...)
+
+		if f.Fin {
+			if typ == TextMessage && !utf8.Valid(data) {
+				return 0, nil, c.protocolError(CloseInvalidFramePayloadData, "invalid utf8 payload")
+			}
+			return typ, data, nil
+		}
+	}
+}
+
+// WriteMessage writes a text or binary message as a single frame.
+func (c *Conn) WriteMessage(typ Opcode, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	return c.WriteFrame(&Frame{Fin: true, Opcode: typ, Payload: data})
+}
+
+// WriteControl writes a control frame.
+func (c *Conn) WriteControl(typ Opcode, data []byte) error {
+	if !typ.IsControl() {
+		return fmt.Errorf("websocket: invalid control type %d", typ)
+	}
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: control payload too big")
+	}
+	return c.WriteFrame(&Frame{Fin: true, Opcode: typ, Payload: data})
+}
+
+// Ping writes a ping frame.
+func (c *Conn) Ping(data []byte) error {
+	return c.WriteControl(PingMessage, data)
+}
+
+// Close performs the closing handshake with the CloseNormalClosure code and
+// closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.CloseWithCode(CloseNormalClosure, "")
+}
+
+// CloseWithCode sends a close frame, waits for the peer close frame and
+// closes the underlying connection.
+func (c *Conn) CloseWithCode(code int, text string) error {
+	err := c.writeClose(code, text)
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		for {
+			f, rerr := c.ReadFrame()
+			if rerr != nil || f.Opcode == CloseMessage {
+				break
+			}
+		}
+	} else if err == ErrCloseSent {
+		err = nil
+	}
+	if cerr := c.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *Conn) writeClose(code int, text string) error {
+	payload := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, text...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	return c.WriteFrame(&Frame{Fin: true, Opcode: CloseMessage, Payload: payload})
+}
+
+func (c *Conn) close() (err error) {
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+	})
+	return
+}
+
+func (c *Conn) protocolError(code int, message string) error {
+	c.writeClose(code, message)
+	return &CloseError{Code: code, Text: message}
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
@@ -0,0 +1,213 @@
+// Package websocket implements RFC 6455 websocket endpoints for xroute.
+//
+// A websocket endpoint is registered like any other handler:
+//
+//	r.Get("/rooms/{room}", websocket.New(func(conn *websocket.Conn) {
+//		for {
+//			typ, msg, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(typ, append([]byte(conn.URLParam("room")+": "), msg...))
+//		}
+//	}))
+//
+// The connection handler runs inside the routing chain, so URL params and
+// RouteContext.Data set by middlewares stay reachable until it returns.
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Handler is the websocket endpoint handler. It performs the opening
+// handshake and calls Handle with the upgraded connection.
+type Handler struct {
+	// Handle is called with the upgraded connection. The connection is closed
+	// after Handle returns.
+	Handle func(conn *Conn)
+
+	// CheckOrigin returns true if the request Origin header is acceptable. If
+	// nil, requests with an Origin header whose host differs from the request
+	// Host are rejected.
+	CheckOrigin func(r *http.Request) bool
+
+	// Subprotocols are the server supported protocols in order of preference.
+	Subprotocols []string
+
+	// ReadLimit is the maximum size in bytes of a read message. Zero means
+	// DefaultReadLimit.
+	ReadLimit int64
+}
+
+// New returns a new websocket endpoint handler.
+func New(handle func(conn *Conn)) *Handler {
+	return &Handler{Handle: handle}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, rctx := xroute.GetOrNewRouteContextForRequest(r)
+	h.ServeHTTPContext(w, r, rctx)
+}
+
+func (h *Handler) ServeHTTPContext(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) {
+	conn, err := h.Upgrade(w, r, rctx)
+	if err != nil {
+		if rctx != nil && rctx.Log != nil {
+			rctx.Log.Debugf("websocket: %v", err)
+		}
+		return
+	}
+	defer conn.close()
+	h.Handle(conn)
+}
+
+// Upgrade performs the opening handshake and returns the server connection.
+// On failure, an HTTP error is replied to the client.
+func (h *Handler) Upgrade(w http.ResponseWriter, r *http.Request, rctx *xroute.RouteContext) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, h.fail(w, http.StatusMethodNotAllowed, "request method is not GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return nil, h.fail(w, http.StatusBadRequest, "'upgrade' token not found in 'Connection' header")
+	}
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, h.fail(w, http.StatusBadRequest, "'websocket' token not found in 'Upgrade' header")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		return nil, h.fail(w, http.StatusUpgradeRequired, "unsupported version")
+	}
+
+	checkOrigin := h.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, h.fail(w, http.StatusForbidden, "origin not allowed")
+	}
+
+	key := r.Header.Get("Sec-Websocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, h.fail(w, http.StatusBadRequest, "invalid 'Sec-WebSocket-Key' header")
+	}
+
+	subprotocol := h.selectSubprotocol(r)
+
+	netConn, brw, err := xroute.HijackResponseWriter(w)
+	if err != nil {
+		return nil, h.fail(w, http.StatusInternalServerError, err.Error())
+	}
+
+	var buf strings.Builder
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	buf.WriteString(computeAcceptKey(key))
+	buf.WriteString("\r\n")
+	if subprotocol != "" {
+		buf.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	for name, values := range w.Header() {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Type", "Content-Encoding", "Transfer-Encoding", "Vary":
+			continue
+		}
+		for _, v := range values {
+			buf.WriteString(name + ": " + v + "\r\n")
+		}
+	}
+	buf.WriteString("\r\n")
+
+	if _, err = netConn.Write([]byte(buf.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	conn := newConn(netConn, brw.Reader, false)
+	conn.Request = r
+	conn.Context = rctx
+	conn.Subprotocol = subprotocol
+	if h.ReadLimit > 0 {
+		conn.ReadLimit = h.ReadLimit
+	}
+	return conn, nil
+}
+
+func (h *Handler) fail(w http.ResponseWriter, status int, reason string) error {
+	http.Error(w, http.StatusText(status), status)
+	return &HandshakeError{reason}
+}
+
+func (h *Handler) selectSubprotocol(r *http.Request) string {
+	if len(h.Subprotocols) == 0 {
+		return ""
+	}
+	requested := headerTokens(r.Header, "Sec-Websocket-Protocol")
+	for _, sp := range h.Subprotocols {
+		for _, rp := range requested {
+			if sp == rp {
+				return sp
+			}
+		}
+	}
+	return ""
+}
+
+// HandshakeError describes an error with the handshake from the peer.
+type HandshakeError struct {
+	message string
+}
+
+func (e HandshakeError) Error() string { return "websocket: handshake: " + e.message }
+
+// IsWebSocketUpgrade returns true if the client requested upgrade to the
+// websocket protocol.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func headerTokens(header http.Header, name string) (tokens []string) {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func wsURL(ts *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(ts.URL, "http") + path
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	var teeBuf bytes.Buffer
+
+	r := xroute.NewRouter()
+	r.Use(func(chain *xroute.ChainHandler) {
+		chain.Context.Data["user"] = "peter"
+		chain.Next()
+	})
+	r.Use(func(chain *xroute.ChainHandler) {
+		chain.Writer.(xroute.WrapResponseWriter).Tee(&teeBuf)
+		chain.Next()
+	})
+	r.Route("/rooms", func(r xroute.Router) {
+		r.Get("/{room}", New(func(conn *Conn) {
+			prefix := conn.URLParam("room") + "/" + conn.Context.Data["user"].(string) + ": "
+			for {
+				typ, msg, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				if err = conn.WriteMessage(typ, append([]byte(prefix), msg...)); err != nil {
+					return
+				}
+			}
+		}))
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	conn, resp, err := Dial(wsURL(ts, "/rooms/go"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err = conn.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	typ, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != TextMessage || string(msg) != "go/peter: hello" {
+		t.Fatalf("unexpected message %d %q", typ, msg)
+	}
+
+	// fragmented binary message
+	conn.WriteFrame(&Frame{Opcode: BinaryMessage, Payload: []byte("ab")})
+	conn.WriteFrame(&Frame{Opcode: ContinuationFrame, Payload: []byte("cd")})
+	conn.WriteFrame(&Frame{Fin: true, Opcode: ContinuationFrame, Payload: []byte("ef")})
+	typ, msg, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != BinaryMessage || string(msg) != "go/peter: abcdef" {
+		t.Fatalf("unexpected message %d %q", typ, msg)
+	}
+
+	// ping is answered with a pong before the next echo
+	pong := make(chan string, 1)
+	conn.PongHandler = func(data []byte) error {
+		pong <- string(data)
+		return nil
+	}
+	if err = conn.Ping([]byte("p1")); err != nil {
+		t.Fatal(err)
+	}
+	conn.WriteMessage(TextMessage, []byte("after ping"))
+	if _, msg, err = conn.ReadMessage(); err != nil || string(msg) != "go/peter: after ping" {
+		t.Fatalf("unexpected message %q: %v", msg, err)
+	}
+	if p := <-pong; p != "p1" {
+		t.Fatalf("unexpected pong %q", p)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if teeBuf.Len() != 0 {
+		t.Fatalf("tee'd writer received hijacked stream: %q", teeBuf.String())
+	}
+}
+
+func TestWebSocketServerClose(t *testing.T) {
+	r := xroute.NewRouter()
+	r.Get("/", New(func(conn *Conn) {
+		conn.CloseWithCode(ClosePolicyViolation, "bye")
+	}))
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	conn, _, err := Dial(wsURL(ts, "/"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	ce, ok := err.(*CloseError)
+	if !ok || ce.Code != ClosePolicyViolation || ce.Text != "bye" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err = conn.WriteMessage(TextMessage, []byte("x")); err != ErrCloseSent {
+		t.Fatalf("expected ErrCloseSent, got %v", err)
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	r := xroute.NewRouter()
+	r.Get("/", &Handler{
+		Handle:       func(conn *Conn) {},
+		Subprotocols: []string{"chat"},
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", resp.StatusCode)
+	}
+
+	header := http.Header{}
+	header.Set("Origin", "http://evil.example.com")
+	if _, resp, err = Dial(wsURL(ts, "/"), header); err != ErrBadHandshake || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden origin, got %v", err)
+	}
+
+	header = http.Header{}
+	header.Set("Sec-WebSocket-Protocol", "other, chat")
+	conn, _, err := Dial(wsURL(ts, "/"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.Subprotocol != "chat" {
+		t.Fatalf("unexpected subprotocol %q", conn.Subprotocol)
+	}
+}
@@ -5,11 +5,16 @@ package xroute
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 )
 
+// ErrNotHijackable is returned by HijackResponseWriter when no writer of the
+// wrapping chain supports connection hijacking.
+var ErrNotHijackable = errors.New("response writer does not support hijacking")
+
 type ResponseWriter interface {
 	http.ResponseWriter
 	// Status returns the HTTP status of the request, or 0 if one has not
@@ -20,13 +25,48 @@ type ResponseWriter interface {
 	HasStatus(status ...int) bool
 }
 
+// NewResponseWriter wraps `w` into a ResponseWriter, keeping the optional
+// interfaces (http.Flusher, http.Hijacker, http.CloseNotifier and
+// io.ReaderFrom) implemented by the proxied writer.
 func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
 	if ws, ok := w.(ResponseWriter); ok {
 		return ws
 	}
+
+	_, fl := w.(http.Flusher)
+	_, hj := w.(http.Hijacker)
+	_, cn := w.(http.CloseNotifier)
+	_, rf := w.(io.ReaderFrom)
+
+	switch {
+	case fl && hj && cn && rf:
+		return &HTTPFancyWriter{BasicWriter{ResponseWriter: w}}
+	case fl && cn:
+		return &HTTP2FancyWriter{BasicWriter{ResponseWriter: w}}
+	case fl:
+		return &FlushWriter{BasicWriter{ResponseWriter: w}}
+	}
 	return &BasicWriter{ResponseWriter: w}
 }
 
+// HijackResponseWriter hijacks the connection of `w`. If `w` does not
+// implements http.Hijacker, the writers returned by successive `Unwrap()`
+// calls are tried. Writers that buffer or transform the body should
+// implement http.Hijacker so they are notified and stop writing.
+func HijackResponseWriter(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	for w != nil {
+		if hj, ok := w.(http.Hijacker); ok {
+			return hj.Hijack()
+		}
+		uw, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = uw.Unwrap()
+	}
+	return nil, nil, ErrNotHijackable
+}
+
 // WrapResponseWriter is a proxy around an http.NewResponseWriter that allows you to hook
 // into various parts of the response process.
 type WrapResponseWriter interface {
@@ -50,6 +90,7 @@ type BasicWriter struct {
 	status      int
 	bytes       int
 	tee         io.Writer
+	hijacked    bool
 }
 
 func (b *BasicWriter) WriteHeader(code int) {
@@ -105,6 +146,22 @@ func (b *BasicWriter) Unwrap() http.ResponseWriter {
 	return b.ResponseWriter
 }
 
+// Hijacked reports whether the underlying connection was hijacked. After
+// hijacking, Status returns 101 and the tee'd writer is detached so that
+// the raw connection stream is never copied.
+func (b *BasicWriter) Hijacked() bool {
+	return b.hijacked
+}
+
+func (b *BasicWriter) setHijacked() {
+	b.hijacked = true
+	b.wroteHeader = true
+	b.tee = nil
+	if b.status == 0 {
+		b.status = http.StatusSwitchingProtocols
+	}
+}
+
 type FlushWriter struct {
 	BasicWriter
 }
@@ -136,14 +193,17 @@ func (f *HTTPFancyWriter) Flush() {
 
 func (f *HTTPFancyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hj := f.BasicWriter.ResponseWriter.(http.Hijacker)
-	return hj.Hijack()
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		f.BasicWriter.setHijacked()
+	}
+	return conn, rw, err
 }
 
 func (f *HTTPFancyWriter) ReadFrom(r io.Reader) (int64, error) {
 	if f.BasicWriter.tee != nil {
-		n, err := io.Copy(&f.BasicWriter, r)
-		f.BasicWriter.bytes += int(n)
-		return n, err
+		// BasicWriter.Write already counts the written bytes
+		return io.Copy(&f.BasicWriter, r)
 	}
 	rf := f.BasicWriter.ResponseWriter.(io.ReaderFrom)
 	f.BasicWriter.maybeWriteHeader()
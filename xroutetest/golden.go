@@ -0,0 +1,108 @@
+package xroutetest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// UpdateEnv is the environment variable that makes Golden write the golden
+// files instead of checking them:
+//
+//	XROUTETEST_UPDATE=1 go test ./...
+const UpdateEnv = "XROUTETEST_UPDATE"
+
+// RouteTable returns the route table of `routes`, a sorted line per method,
+// pattern and constraints, followed by the metadata and the middleware names.
+// Anonymous middlewares are shown as `-`. The redirect and rewrite rules of
+// the routers (see xroute.Mux.Rules) are shown as `RULE` lines.
+func RouteTable(routes xroute.Routes) string {
+	var lines []string
+	xroute.WalkEndpoints(routes, func(method string, route string, v xroute.EndpointVariant, middlewares ...*xroute.Middleware) error {
+		line := method + " " + route
+		if c := v.Constraints.String(); c != "" {
+			line += " " + c
+		}
+		if len(v.Meta) > 0 {
+			line += " " + formatMeta(v.Meta)
+		}
+		if len(middlewares) > 0 {
+			names := make([]string, len(middlewares))
+			for i, md := range middlewares {
+				if names[i] = md.Name; names[i] == "" {
+					names[i] = "-"
+				}
+			}
+			line += " (" + strings.Join(names, ", ") + ")"
+		}
+		lines = append(lines, line)
+		return nil
+	})
+	lines = append(lines, ruleLines(routes, "")...)
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ruleLines returns the rule lines of the router and its sub-routers, with
+// the patterns prefixed by the mount `prefix`.
+func ruleLines(routes xroute.Routes, prefix string) (lines []string) {
+	if mx, ok := routes.(*xroute.Mux); ok && mx.Rules != nil {
+		for _, rule := range mx.Rules.Rules() {
+			r := *rule
+			r.Match = prefix + r.Match
+			if r.IsRewrite() {
+				r.Target = prefix + r.Target
+			}
+			lines = append(lines, "RULE "+r.String())
+		}
+	}
+	for _, route := range routes.Routes() {
+		if route.SubRoutes != nil {
+			lines = append(lines, ruleLines(route.SubRoutes, prefix+strings.TrimSuffix(route.Pattern, "/*"))...)
+		}
+	}
+	return
+}
+
+func formatMeta(meta xroute.Meta) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + meta.String(k)
+	}
+	return "{" + strings.Join(keys, " ") + "}"
+}
+
+// Golden asserts the route table of `routes` matches the golden file
+// `path`. If the UpdateEnv environment variable is set, the golden file is
+// written instead.
+func Golden(t testing.TB, routes xroute.Routes, path string) {
+	t.Helper()
+	table := RouteTable(routes)
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("xroutetest: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(table), 0644); err != nil {
+			t.Fatalf("xroutetest: %v", err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("xroutetest: %v (set %s=1 to create it)", err, UpdateEnv)
+	}
+	if string(data) != table {
+		t.Fatalf("xroutetest: route table doesn't match %s (set %s=1 to update it):\n--- expected\n%s--- got\n%s", path, UpdateEnv, data, table)
+	}
+}
@@ -0,0 +1,250 @@
+package xroutetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Response is the served request result. Assertions fail the test and
+// return the response, so they can be chained.
+type Response struct {
+	*httptest.ResponseRecorder
+
+	t testing.TB
+
+	// Request is the served request.
+	Request *http.Request
+	// Context is the route context of the request.
+	Context *xroute.RouteContext
+	// Endpoint is the endpoint handler that served the request, or nil.
+	Endpoint interface{}
+	// MiddlewaresRun are the names of the named middlewares, in the order
+	// they ran.
+	MiddlewaresRun []string
+}
+
+func (r *Response) fatalf(format string, args ...interface{}) {
+	r.t.Helper()
+	r.t.Fatalf("%s %s: "+format, append([]interface{}{r.Request.Method, r.Request.URL.RequestURI()}, args...)...)
+}
+
+// Status asserts the response status.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Code != code {
+		r.fatalf("expected status %d, got %d (body %q)", code, r.Code, r.ResponseRecorder.Body.String())
+	}
+	return r
+}
+
+// Header asserts the response header `key`.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got, ok := r.Result().Header[http.CanonicalHeaderKey(key)]; !ok || got[0] != value {
+		r.fatalf("expected header %s %q, got %q", key, value, got)
+	}
+	return r
+}
+
+// NoHeader asserts the response header `key` isn't set.
+func (r *Response) NoHeader(key string) *Response {
+	r.t.Helper()
+	if got, ok := r.Result().Header[http.CanonicalHeaderKey(key)]; ok {
+		r.fatalf("unexpected header %s %q", key, got)
+	}
+	return r
+}
+
+// Body asserts the response body.
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if got := r.ResponseRecorder.Body.String(); got != body {
+		r.fatalf("expected body %q, got %q", body, got)
+	}
+	return r
+}
+
+// BodyContains asserts the response body contains `s`.
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+	if got := r.ResponseRecorder.Body.String(); !strings.Contains(got, s) {
+		r.fatalf("expected body containing %q, got %q", s, got)
+	}
+	return r
+}
+
+// JSON asserts the JSON response body equals the JSON encoding of
+// `expected`.
+func (r *Response) JSON(expected interface{}) *Response {
+	r.t.Helper()
+	return r.JSONPath("", expected)
+}
+
+// JSONPath asserts the value at the dot separated `path` of the JSON response
+// body equals the JSON encoding of `expected`. Array elements are selected by
+// index, for example `items.0.id`. An empty path selects the whole body.
+func (r *Response) JSONPath(path string, expected interface{}) *Response {
+	r.t.Helper()
+
+	var got interface{}
+	if err := json.Unmarshal(r.ResponseRecorder.Body.Bytes(), &got); err != nil {
+		r.fatalf("invalid JSON body: %v", err)
+	}
+
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch v := got.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if got, ok = v[key]; !ok {
+					r.fatalf("JSON path %q: key %q not found", path, key)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(v) {
+					r.fatalf("JSON path %q: bad index %q", path, key)
+				}
+				got = v[i]
+			default:
+				r.fatalf("JSON path %q: %q isn't an object or array", path, key)
+			}
+		}
+	}
+
+	var want interface{}
+	data, err := json.Marshal(expected)
+	if err == nil {
+		err = json.Unmarshal(data, &want)
+	}
+	if err != nil {
+		r.fatalf("JSON path %q: bad expected value: %v", path, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotData, _ := json.Marshal(got)
+		r.fatalf("JSON path %q: expected %s, got %s", path, data, gotData)
+	}
+	return r
+}
+
+// Pattern asserts the matched route pattern.
+func (r *Response) Pattern(pattern string) *Response {
+	r.t.Helper()
+	if got := r.Context.RoutePattern(); got != pattern {
+		r.fatalf("expected route pattern %q, got %q", pattern, got)
+	}
+	return r
+}
+
+// Param asserts the URL param `key`.
+func (r *Response) Param(key, value string) *Response {
+	r.t.Helper()
+	if v := r.Context.URLParams.GetValue(key); v == nil || *v.Value != value {
+		r.fatalf("expected URL param %s %q, got %q", key, value, r.Context.URLParams.Dict()[key])
+	}
+	return r
+}
+
+// ApiExt asserts the matched API extension.
+func (r *Response) ApiExt(ext string) *Response {
+	r.t.Helper()
+	if r.Context.ApiExt != ext {
+		r.fatalf("expected API extension %q, got %q", ext, r.Context.ApiExt)
+	}
+	return r
+}
+
+// EndpointHeaders asserts the header constraints of the endpoint handler
+// that served the request. Nil means no constraints.
+func (r *Response) EndpointHeaders(headers http.Header) *Response {
+	r.t.Helper()
+	if len(headers) != len(r.Context.EndpointHeaders) ||
+		(len(headers) > 0 && !reflect.DeepEqual(headers, r.Context.EndpointHeaders)) {
+		r.fatalf("expected endpoint headers %v, got %v", headers, r.Context.EndpointHeaders)
+	}
+	return r
+}
+
+// EndpointConstraints asserts the constraints of the endpoint handler that
+// served the request, as formatted by xroute.Constraints.String, for example
+// `[Accept=text/csv ?format=csv]`. Empty means no constraints.
+func (r *Response) EndpointConstraints(constraints string) *Response {
+	r.t.Helper()
+	if got := r.Context.EndpointConstraints.String(); got != constraints {
+		r.fatalf("expected endpoint constraints %q, got %q", constraints, got)
+	}
+	return r
+}
+
+// Meta asserts the metadata `key` of the endpoint handler that served the
+// request. Values are compared formatted as strings.
+func (r *Response) Meta(key, value string) *Response {
+	r.t.Helper()
+	if _, ok := r.Context.Meta[key]; !ok || r.Context.Meta.String(key) != value {
+		r.fatalf("expected metadata %s %q, got %q", key, value, r.Context.Meta.String(key))
+	}
+	return r
+}
+
+// Handler asserts the request was served by `handler`. Functions are compared
+// by code pointer, so closures of the same function literal are equal.
+func (r *Response) Handler(handler interface{}) *Response {
+	r.t.Helper()
+	if r.Endpoint == nil {
+		r.fatalf("no endpoint handler was called")
+	}
+	if handlerID(r.Endpoint) != handlerID(handler) {
+		r.fatalf("served by unexpected handler %T", unwrapHandler(r.Endpoint))
+	}
+	return r
+}
+
+// Middlewares asserts the names of the named middlewares, in the order they
+// ran.
+func (r *Response) Middlewares(names ...string) *Response {
+	r.t.Helper()
+	if len(names) != len(r.MiddlewaresRun) || (len(names) > 0 && !reflect.DeepEqual(names, r.MiddlewaresRun)) {
+		r.fatalf("expected middlewares %q, got %q", names, r.MiddlewaresRun)
+	}
+	return r
+}
+
+// unwrapHandler returns the user handler wrapped by xroute.HttpHandler.
+func unwrapHandler(h interface{}) interface{} {
+	for {
+		switch ht := h.(type) {
+		case *xroute.HttpContextHandler:
+			h = ht.ContextHandler
+		case *xroute.HTTPHandlerFunc:
+			return ht.Value
+		case *xroute.HTTPHandler:
+			h = ht.Value
+		case *xroute.RouteContextFuncHandler:
+			return ht.Value
+		case *xroute.RouteContextArgHandler:
+			return ht.Value
+		case *xroute.RouteInterfaceHandler:
+			return ht.Value
+		default:
+			return h
+		}
+	}
+}
+
+func handlerID(h interface{}) interface{} {
+	h = unwrapHandler(h)
+	v := reflect.ValueOf(h)
+	switch v.Kind() {
+	case reflect.Func:
+		return v.Pointer()
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Slice:
+		return [2]interface{}{v.Type(), v.Pointer()}
+	}
+	return h
+}
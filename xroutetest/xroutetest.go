@@ -0,0 +1,151 @@
+// Package xroutetest runs requests against routers, with no network, and
+// asserts on the response and on the resulting RouteContext.
+//
+//	x := xroutetest.New(t, r)
+//	x.Get("/users/7.json").Header("Accept", "application/json").Do().
+//		Status(200).
+//		Pattern("/users/{id}").
+//		Param("id", "7").
+//		ApiExt("json").
+//		Middlewares("auth", "cache").
+//		JSONPath("user.id", 7)
+package xroutetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+// Tester builds requests to a handler.
+type Tester struct {
+	t       testing.TB
+	handler xroute.ContextHandler
+
+	// Header is the default header of the requests.
+	Header http.Header
+}
+
+// New returns a tester of `handler`: a Router or any handler accepted by
+// xroute.HttpHandler.
+func New(t testing.TB, handler interface{}) *Tester {
+	return &Tester{t: t, handler: xroute.HttpHandler(handler), Header: http.Header{}}
+}
+
+// Request returns a new request builder.
+func (x *Tester) Request(method, target string) *Request {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range x.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	return &Request{t: x.t, handler: x.handler, req: req}
+}
+
+func (x *Tester) Get(target string) *Request     { return x.Request("GET", target) }
+func (x *Tester) Head(target string) *Request    { return x.Request("HEAD", target) }
+func (x *Tester) Post(target string) *Request    { return x.Request("POST", target) }
+func (x *Tester) Put(target string) *Request     { return x.Request("PUT", target) }
+func (x *Tester) Patch(target string) *Request   { return x.Request("PATCH", target) }
+func (x *Tester) Delete(target string) *Request  { return x.Request("DELETE", target) }
+func (x *Tester) Options(target string) *Request { return x.Request("OPTIONS", target) }
+
+// Request is a request builder.
+type Request struct {
+	t       testing.TB
+	handler xroute.ContextHandler
+	req     *http.Request
+}
+
+// Header sets the header `key`.
+func (r *Request) Header(key, value string) *Request {
+	r.req.Header.Set(key, value)
+	return r
+}
+
+// Query adds the query parameter `key`.
+func (r *Request) Query(key, value string) *Request {
+	q := r.req.URL.Query()
+	q.Add(key, value)
+	r.req.URL.RawQuery = q.Encode()
+	r.req.RequestURI = r.req.URL.RequestURI()
+	return r
+}
+
+// Cookie adds a cookie.
+func (r *Request) Cookie(name, value string) *Request {
+	r.req.AddCookie(&http.Cookie{Name: name, Value: value})
+	return r
+}
+
+// Body sets the request body.
+func (r *Request) Body(body io.Reader) *Request {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, body); err != nil {
+		r.t.Fatalf("xroutetest: read body: %v", err)
+	}
+	r.req.Body = ioutil.NopCloser(&buf)
+	r.req.ContentLength = int64(buf.Len())
+	return r
+}
+
+// String sets the request body to `body`.
+func (r *Request) String(body string) *Request {
+	return r.Body(strings.NewReader(body))
+}
+
+// JSON sets the request body to the JSON encoding of `v`.
+func (r *Request) JSON(v interface{}) *Request {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.t.Fatalf("xroutetest: encode JSON body: %v", err)
+	}
+	r.req.Header.Set("Content-Type", "application/json")
+	return r.Body(bytes.NewReader(data))
+}
+
+// Form sets the request body to the URL encoded `values`.
+func (r *Request) Form(values url.Values) *Request {
+	r.req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r.String(values.Encode())
+}
+
+// WithContext sets the request context.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.req = r.req.WithContext(ctx)
+	return r
+}
+
+// Do serves the request and returns the response.
+func (r *Request) Do() *Response {
+	res := &Response{t: r.t, ResponseRecorder: httptest.NewRecorder()}
+
+	rctx := xroute.NewRouteContext()
+	if routes, ok := r.handler.(xroute.Routes); ok {
+		rctx.Routes = routes
+	}
+	rctx.Observe(xroute.ObserverFunc(func(step *xroute.Step) func() {
+		switch step.Kind {
+		case xroute.StepMiddleware:
+			if step.Middleware.Name != "" {
+				res.MiddlewaresRun = append(res.MiddlewaresRun, step.Middleware.Name)
+			}
+		case xroute.StepEndpoint:
+			res.Endpoint = step.Handler
+		}
+		return nil
+	}))
+
+	res.Request = xroute.SetRouteContextToRequest(r.req, rctx)
+	res.Context = rctx
+	r.handler.ServeHTTPContext(res.ResponseRecorder, res.Request, rctx)
+	return res
+}
@@ -0,0 +1,128 @@
+package xroutetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/moisespsena-go/xroute"
+)
+
+func named(name string) *xroute.Middleware {
+	return &xroute.Middleware{Name: name, Handler: func(chain *xroute.ChainHandler) {
+		chain.Writer.Header().Add("X-Middleware", name)
+		chain.Next()
+	}}
+}
+
+func showUser(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user": map[string]interface{}{"id": xroute.URLParam(r, "id"), "roles": []string{"admin", "dev"}},
+	})
+}
+
+func showUserV2(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("v2"))
+}
+
+func showUserCSV(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("id\n" + xroute.URLParam(r, "id") + "\n"))
+}
+
+func showUserBeta(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("beta"))
+}
+
+func newRouter() xroute.Router {
+	r := xroute.NewRouter()
+	r.Use(named("auth"), xroute.Meta{"owner": "core"})
+	r.Use(func(chain *xroute.ChainHandler) {
+		chain.Next()
+	})
+	r.Api(func(r xroute.Router) {
+		r.With(named("cache")).Get("/users/{id}", showUser)
+	})
+	r.Headers(http.Header{"Accept-Version": []string{"2"}}, func(r xroute.Router) {
+		r.Get("/users/{id}", showUserV2)
+	})
+	r.Query(url.Values{"format": []string{"csv"}}, func(r xroute.Router) {
+		r.Get("/users/{id}", showUserCSV)
+	})
+	r.When("internal", func(r *http.Request, rctx *xroute.RouteContext) bool {
+		return r.Header.Get("X-Internal") == "1"
+	}, func(r xroute.Router) {
+		r.Cookies(url.Values{"beta": []string{"1"}}, func(r xroute.Router) {
+			r.Get("/users/{id}", showUserBeta)
+		})
+	})
+	r.Route("/items", func(r xroute.Router) {
+		r.Api(func(r xroute.Router) {
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("[]"))
+			})
+		})
+	})
+	r.With(xroute.Meta{"perm": "users.create"}).Post("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	r.Rules = xroute.MustRules(&xroute.Rule{Match: "/members/{id}", Target: "/users/{id}", Status: http.StatusMovedPermanently})
+	return r
+}
+
+func TestTester(t *testing.T) {
+	x := New(t, newRouter())
+
+	x.Get("/users/7.json").Do().
+		Status(200).
+		Header("X-Middleware", "auth").
+		Pattern("/users/{id}").
+		Param("id", "7").
+		Handler(showUser).
+		EndpointHeaders(nil).
+		Middlewares("auth", "cache").
+		Meta("owner", "core").
+		JSONPath("user.id", "7").
+		JSONPath("user.roles.1", "dev").
+		JSON(map[string]interface{}{"user": map[string]interface{}{"id": "7", "roles": []string{"admin", "dev"}}})
+
+	x.Get("/users/7").Header("Accept-Version", "2").Do().
+		Status(200).
+		Body("v2").
+		Handler(showUserV2).
+		EndpointHeaders(http.Header{"Accept-Version": []string{"2"}}).
+		EndpointConstraints("[Accept-Version=2]").
+		Middlewares("auth")
+
+	x.Get("/users/7").Query("format", "csv").Do().
+		Body("id\n7\n").
+		EndpointConstraints("[?format=csv]")
+
+	// as specific as the header constraint, registered later
+	x.Get("/users/7").Query("format", "csv").Header("Accept-Version", "2").Do().
+		Handler(showUserV2)
+
+	x.Get("/users/7").Query("format", "csv").Header("X-Internal", "1").Cookie("beta", "1").Do().
+		Handler(showUserBeta).
+		EndpointConstraints("[cookie:beta=1 if:internal]")
+
+	x.Get("/users/7").Header("X-Internal", "1").Do().
+		Handler(showUser).
+		EndpointConstraints("")
+
+	x.Get("/items.json").Do().
+		Status(200).
+		ApiExt("json").
+		JSON([]int{})
+
+	res := x.Post("/users").JSON(map[string]string{"name": "x"}).Do().
+		Status(http.StatusCreated).
+		NoHeader("Location")
+	if res.Request.Header.Get("Content-Type") != "application/json" || res.Request.ContentLength != 12 {
+		t.Fatalf("unexpected request %v", res.Request)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	Golden(t, newRouter(), "testdata/routes.golden")
+}